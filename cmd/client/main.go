@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"goapp/internal/pkg/codec"
+
+	"github.com/gorilla/websocket"
+)
+
+// protocolVersion is the version of the command envelope.
+const protocolVersion = 1
+
+// wsMessage is a message of the server: a value, or an envelope with a type
+// for heartbeats, notices, announcements and command replies.
+type wsMessage struct {
+	Iteration int        `json:"iteration,omitempty"`
+	Value     string     `json:"value,omitempty"`
+	Version   int        `json:"version,omitempty"`
+	Type      string     `json:"type,omitempty"`
+	Payload   *wsPayload `json:"payload,omitempty"`
+}
+
+// wsPayload holds the payload fields of the envelopes the client reads.
+type wsPayload struct {
+	Seq     uint64      `json:"seq,omitempty"`     // Heartbeat sequence.
+	Text    string      `json:"text,omitempty"`    // Notice text.
+	Data    interface{} `json:"data,omitempty"`    // Notice data.
+	Code    string      `json:"code,omitempty"`    // Error code.
+	Message string      `json:"message,omitempty"` // Error message.
+}
+
+type client struct {
+	id       int
+	url      string
+	codec    codec.Codec
+	conn     *websocket.Conn
+	done     chan struct{}
+	messages chan wsMessage
+}
+
+func newClient(id int, serverURL string, cdc codec.Codec) *client {
+	return &client{
+		id:       id,
+		url:      serverURL,
+		codec:    cdc,
+		done:     make(chan struct{}),
+		messages: make(chan wsMessage, 100),
+	}
+}
+
+func (c *client) connect() error {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{c.codec.Name()}
+	header := http.Header{"Origin": {"http://" + u.Host}}
+
+	conn, _, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		return fmt.Errorf("dial error: %w", err)
+	}
+	if conn.Subprotocol() != c.codec.Name() {
+		conn.Close()
+		return fmt.Errorf("server does not support %s encoding", c.codec.Name())
+	}
+
+	c.conn = conn
+	return nil
+}
+
+func (c *client) start(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(c.messages)
+
+	go func() {
+		defer close(c.done)
+		for {
+			_, message, err := c.conn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) && !errors.Is(err, websocket.ErrCloseSent) {
+					log.Printf("[conn #%d] read error: %v", c.id, err)
+				}
+				return
+			}
+
+			var msg wsMessage
+			if err := c.codec.Unmarshal(message, &msg); err != nil {
+				log.Printf("[conn #%d] parse error: %v", c.id, err)
+				continue
+			}
+
+			// Heartbeats are echoed for the server to measure the round trip.
+			if msg.Type == "heartbeat" {
+				if err := c.echo(msg); err != nil {
+					log.Printf("[conn #%d] heartbeat error: %v", c.id, err)
+					return
+				}
+				continue
+			}
+
+			select {
+			case c.messages <- msg:
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(54 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				log.Printf("[conn #%d] ping error: %v", c.id, err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// echo sends a heartbeat back with its sequence. Only the reader goroutine
+// writes messages.
+func (c *client) echo(heartbeat wsMessage) error {
+	if heartbeat.Payload == nil {
+		return fmt.Errorf("heartbeat without payload")
+	}
+	data, err := c.codec.Marshal(wsMessage{
+		Version: protocolVersion,
+		Type:    "heartbeat",
+		Payload: &wsPayload{Seq: heartbeat.Payload.Seq},
+	})
+	if err != nil {
+		return err
+	}
+
+	messageType := websocket.TextMessage
+	if c.codec.Binary() {
+		messageType = websocket.BinaryMessage
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// print writes a server message to the standard output.
+func (c *client) print(msg wsMessage) {
+	p := msg.Payload
+	if p == nil {
+		p = &wsPayload{}
+	}
+
+	switch msg.Type {
+	case "":
+		fmt.Printf("[conn #%d] iteration: %d, value: %s\n", c.id, msg.Iteration, msg.Value)
+	case "notice", "announcement":
+		if p.Data != nil {
+			fmt.Printf("[conn #%d] %s: %s %v\n", c.id, msg.Type, p.Text, p.Data)
+		} else {
+			fmt.Printf("[conn #%d] %s: %s\n", c.id, msg.Type, p.Text)
+		}
+	case "error":
+		fmt.Printf("[conn #%d] error: %s: %s\n", c.id, p.Code, p.Message)
+	default:
+		fmt.Printf("[conn #%d] %s\n", c.id, msg.Type)
+	}
+}
+
+func (c *client) stop() {
+	if c.conn != nil {
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		time.Sleep(100 * time.Millisecond)
+		c.conn.Close()
+	}
+}
+
+func main() {
+	var (
+		numConnections int
+		encoding       string
+	)
+	flag.IntVar(&numConnections, "n", 1, "number of parallel connections")
+	flag.StringVar(&encoding, "encoding", codec.JSON.Name(), fmt.Sprintf("message encoding, one of %v", codec.Names()))
+	flag.Parse()
+
+	if numConnections < 1 {
+		log.Fatal("number of connections must be positive")
+	}
+
+	cdc := codec.Lookup(encoding)
+	if cdc == nil {
+		log.Fatalf("unknown encoding %q", encoding)
+	}
+
+	// Setup signal handling
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	clients := make([]*client, numConnections)
+	var wg sync.WaitGroup
+
+	for i := 0; i < numConnections; i++ {
+		clients[i] = newClient(i, "ws://localhost:8080/goapp/ws", cdc)
+		if err := clients[i].connect(); err != nil {
+			log.Fatalf("failed to connect client %d: %v", i, err)
+		}
+		defer clients[i].stop()
+
+		wg.Add(1)
+		go clients[i].start(ctx, &wg)
+	}
+
+	for _, c := range clients {
+		go func(cl *client) {
+			for msg := range cl.messages {
+				cl.print(msg)
+			}
+		}(c)
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+}
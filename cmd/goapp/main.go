@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	goapp "goapp/internal/app/server"
+	"goapp/internal/pkg/logging"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	cfg := goapp.DefaultConfig()
+	logCfg := logging.DefaultConfig()
+	var peers string
+	flag.StringVar(&logCfg.Format, "log-format", logCfg.Format, "log format, text or json")
+	flag.StringVar(&logCfg.Level, "log-level", logCfg.Level, "lowest level logged, debug, info, warn or error")
+	flag.StringVar(&cfg.HTTP.Addr, "addr", cfg.HTTP.Addr, "HTTP listen address")
+	flag.IntVar(&cfg.HTTP.ReadBufferSize, "ws-read-buffer", cfg.HTTP.ReadBufferSize, "WebSocket read buffer size")
+	flag.IntVar(&cfg.HTTP.WriteBufferSize, "ws-write-buffer", cfg.HTTP.WriteBufferSize, "WebSocket write buffer size")
+	flag.BoolVar(&cfg.HTTP.Compression, "ws-compression", cfg.HTTP.Compression, "negotiate permessage-deflate with WebSocket clients")
+	flag.IntVar(&cfg.HTTP.CompressionLevel, "ws-compression-level", cfg.HTTP.CompressionLevel, "deflate level, from -2 (Huffman only) to 9 (best compression)")
+	flag.IntVar(&cfg.HTTP.CompressionMin, "ws-compression-min", cfg.HTTP.CompressionMin, "minimum message size in bytes to compress")
+	flag.StringVar(&cfg.HTTP.Engine, "ws-engine", cfg.HTTP.Engine, "WebSocket engine, goroutine or epoll (Linux only)")
+	flag.IntVar(&cfg.HTTP.EngineWorkers, "ws-engine-workers", cfg.HTTP.EngineWorkers, "workers of the epoll engine, 0 runs one per CPU")
+	flag.DurationVar(&cfg.HTTP.DrainTimeout, "drain-timeout", cfg.HTTP.DrainTimeout, "wait for WebSocket clients to close on shutdown")
+	flag.DurationVar(&cfg.HTTP.HeartbeatInterval, "heartbeat-interval", cfg.HTTP.HeartbeatInterval, "WebSocket heartbeat interval, 0 disables heartbeats")
+	flag.IntVar(&cfg.HTTP.HistorySize, "history-size", cfg.HTTP.HistorySize, "number of recent values kept for stream resumption")
+	flag.IntVar(&cfg.HTTP.MaxPollSessions, "max-poll-sessions", cfg.HTTP.MaxPollSessions, "long-polling sessions open at once, 0 for no limit")
+	flag.DurationVar(&cfg.HTTP.PollIdleTimeout, "poll-idle-timeout", cfg.HTTP.PollIdleTimeout, "close long-polling sessions not polled for this long")
+	flag.StringVar(&cfg.HTTP.AdminUser, "admin-user", cfg.HTTP.AdminUser, "user of the admin endpoints")
+	flag.StringVar(&cfg.HTTP.AdminPassword, "admin-password", os.Getenv("GOAPP_ADMIN_PASSWORD"), "password of the admin endpoints, empty disables them (default $GOAPP_ADMIN_PASSWORD)")
+	flag.BoolVar(&cfg.HTTP.Summary.Log, "session-summary-log", cfg.HTTP.Summary.Log, "log the summary of every ended session")
+	flag.StringVar(&cfg.HTTP.Summary.File, "session-summary-file", cfg.HTTP.Summary.File, "append the session summaries to this file as JSON lines")
+	flag.StringVar(&cfg.HTTP.Summary.Webhook, "session-summary-webhook", cfg.HTTP.Summary.Webhook, "POST every session summary as JSON to this URL")
+	flag.StringVar(&cfg.HTTP.AdminAddr, "admin-addr", cfg.HTTP.AdminAddr, "admin listener address serving /goapp/debug without credentials, keep it private, empty disables it")
+	flag.StringVar(&cfg.HTTP.SessionDB, "session-db", cfg.HTTP.SessionDB, "database file keeping the session summaries for the history endpoints, empty disables it")
+	flag.DurationVar(&cfg.HTTP.SessionRetention, "session-db-retention", cfg.HTTP.SessionRetention, "age of the sessions pruned from the session database, the hourly rollups are kept, 0 keeps them")
+	flag.StringVar(&cfg.GRPC.Addr, "grpc-addr", cfg.GRPC.Addr, "gRPC listen address, empty disables gRPC")
+	flag.StringVar(&cfg.TCP.Addr, "tcp-addr", cfg.TCP.Addr, "TCP line protocol listen address, empty disables it")
+	flag.StringVar(&cfg.NodeID, "node-id", cfg.NodeID, "cluster node ID (default cluster address)")
+	flag.StringVar(&cfg.ClusterAddr, "cluster-addr", cfg.ClusterAddr, "cluster peer listen address, empty runs a single node")
+	flag.StringVar(&peers, "cluster-peers", "", "comma separated cluster peer addresses")
+	flag.StringVar(&cfg.Tracing.Exporter, "trace-exporter", cfg.Tracing.Exporter, "span exporter, otlp or stdout, empty disables tracing")
+	flag.StringVar(&cfg.Tracing.Endpoint, "trace-endpoint", cfg.Tracing.Endpoint, "OTLP/HTTP collector URL (default $OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318)")
+	flag.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", cfg.Tracing.SampleRatio, "share of the traces that are recorded, including those continued from clients, from 0 to 1")
+	flag.Parse()
+
+	if err := logging.Setup(logCfg, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if peers != "" {
+		cfg.ClusterPeers = strings.Split(peers, ",")
+	}
+
+	exitChannel := make(chan os.Signal, 1)
+	signal.Notify(exitChannel, syscall.SIGINT, syscall.SIGTERM)
+
+	if err := goapp.Start(exitChannel, cfg); err != nil {
+		logging.Fatal("fatal error", logging.Err(err))
+	}
+}
@@ -0,0 +1,25 @@
+package goapp
+
+import (
+	"goapp/internal/pkg/grpcsrv"
+	"goapp/internal/pkg/httpsrv"
+	"goapp/internal/pkg/tcpsrv"
+	"goapp/internal/pkg/tracing"
+)
+
+type Config struct {
+	HTTP         httpsrv.Config // HTTP server.
+	GRPC         grpcsrv.Config // gRPC server, shares the HTTP server sessions.
+	TCP          tcpsrv.Config  // TCP line protocol listener, shares the HTTP server sessions.
+	NodeID       string         // Cluster node ID, defaults to ClusterAddr or the HTTP address.
+	ClusterAddr  string         // Peer listen address, empty runs a single node.
+	ClusterPeers []string       // Peer listen addresses of the other nodes.
+	Tracing      tracing.Config // Span export.
+}
+
+func DefaultConfig() Config {
+	return Config{
+		HTTP:    httpsrv.DefaultConfig(),
+		Tracing: tracing.DefaultConfig(),
+	}
+}
@@ -2,24 +2,60 @@ package goapp
 
 import (
 	"fmt"
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/election"
+	"goapp/internal/pkg/grpcsrv"
 	"goapp/internal/pkg/httpsrv"
+	"goapp/internal/pkg/logging"
+	"goapp/internal/pkg/metrics"
 	"goapp/internal/pkg/strgen"
-	"log"
+	"goapp/internal/pkg/tcpsrv"
+	"goapp/internal/pkg/tracing"
+	"log/slog"
 	"os"
 )
 
-func Start(exitChannel chan os.Signal) error {
+func Start(exitChannel chan os.Signal, cfg Config) error {
 	var (
-		strChan = make(chan string, 100) // String channel with max parallel counter processes.
-		strCli  = strgen.New(strChan)    // String generator.
-		httpSrv = httpsrv.New(strChan)   // HTTP server.
+		strChan = make(chan string, 100)        // String channel with max parallel counter processes.
+		msgBus  = newBroker(cfg)                // Value fan-out to all nodes.
+		elector = newElector(cfg, msgBus)       // Picks the node running the generator.
+		httpSrv = httpsrv.New(cfg.HTTP, msgBus) // HTTP server.
+		quit    = make(chan struct{})           // Quit generator and relay.
+		tracer  = tracing.New(cfg.Tracing)      // Span export.
 	)
 
-	// Start String Generator.
-	if err := strCli.Start(); err != nil {
-		return fmt.Errorf("failed to start string generator: %w", err)
+	metrics.RegisterStrChan(strChan)
+
+	// Start tracing first, the other parts trace with the global provider.
+	if err := tracer.Start(); err != nil {
+		return fmt.Errorf("failed to start tracing: %w", err)
+	}
+	defer tracer.Stop()
+
+	// Start broker.
+	if err := msgBus.Start(); err != nil {
+		return fmt.Errorf("failed to start broker: %w", err)
 	}
-	defer strCli.Stop()
+	defer msgBus.Stop()
+
+	// Start elector.
+	if err := elector.Start(); err != nil {
+		return fmt.Errorf("failed to start elector: %w", err)
+	}
+	defer elector.Stop()
+
+	// Run the String Generator while leading and relay its strings to the broker.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		generate(strChan, elector, quit)
+	}()
+	go relay(strChan, msgBus, quit)
+	defer func() {
+		close(quit)
+		<-done
+	}()
 
 	// Start HTTP server.
 	if err := httpSrv.Start(); err != nil {
@@ -27,10 +63,106 @@ func Start(exitChannel chan os.Signal) error {
 	}
 	defer httpSrv.Stop()
 
-	log.Println("GoApp Started")
-	defer log.Println("GoApp Stopped")
+	// Start gRPC server.
+	if cfg.GRPC.Addr != "" {
+		grpcSrv := grpcsrv.New(cfg.GRPC, httpSrv)
+		if err := grpcSrv.Start(); err != nil {
+			return fmt.Errorf("failed to start gRPC server: %w", err)
+		}
+		defer grpcSrv.Stop()
+	}
+
+	// Start TCP line protocol listener.
+	if cfg.TCP.Addr != "" {
+		tcpSrv := tcpsrv.New(cfg.TCP, httpSrv)
+		if err := tcpSrv.Start(); err != nil {
+			return fmt.Errorf("failed to start TCP listener: %w", err)
+		}
+		defer tcpSrv.Stop()
+	}
+
+	slog.Info("GoApp Started")
+	defer slog.Info("GoApp Stopped")
 
 	<-exitChannel
 
 	return nil
 }
+
+func nodeID(cfg Config) string {
+	switch {
+	case cfg.NodeID != "":
+		return cfg.NodeID
+	case cfg.ClusterAddr != "":
+		return cfg.ClusterAddr
+	default:
+		return cfg.HTTP.Addr
+	}
+}
+
+func newBroker(cfg Config) broker.Broker {
+	if cfg.ClusterAddr == "" {
+		return broker.NewLocal()
+	}
+
+	return broker.NewTCP(broker.TCPConfig{
+		NodeID: nodeID(cfg),
+		Addr:   cfg.ClusterAddr,
+		Peers:  cfg.ClusterPeers,
+	})
+}
+
+func newElector(cfg Config, b broker.Broker) *election.Elector {
+	ecfg := election.Config{
+		NodeID:   nodeID(cfg),
+		Interval: broker.HeartbeatInterval,
+		Settle:   broker.PeerTimeout,
+	}
+	if members, ok := b.(election.Membership); ok {
+		ecfg.Members = members
+	}
+	return election.New(ecfg)
+}
+
+// generate runs a String Generator for as long as this node is the leader,
+// so a single node in the cluster generates and the others relay.
+func generate(strChan chan<- string, e *election.Elector, quit <-chan struct{}) {
+	var strCli *strgen.StringGenerator
+	defer func() {
+		if strCli != nil {
+			strCli.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case leader := <-e.Changes():
+			if leader && strCli == nil {
+				strCli = strgen.New(strChan)
+				if err := strCli.Start(); err != nil {
+					slog.Error("failed to start string generator", logging.Err(err))
+					strCli = nil
+				}
+			} else if !leader && strCli != nil {
+				strCli.Stop()
+				strCli = nil
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func relay(strChan <-chan string, b broker.Broker, quit <-chan struct{}) {
+	for {
+		select {
+		case str := <-strChan:
+			metrics.Generated.Inc()
+			if err := b.Publish(str); err != nil {
+				return
+			}
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package broker
+
+import (
+	"time"
+)
+
+// Message is a generated value as it travels from the generator to the
+// sessions. Seq is assigned by the node that published the value and is
+// strictly increasing for a single publisher.
+type Message struct {
+	Seq   uint64    `json:"seq"`
+	Value string    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Broker fans published values out to every subscriber of the hub, either
+// within a single process or across goapp nodes.
+type Broker interface {
+	// Start broker, Stop() must be called at the end.
+	Start() error
+	Stop()
+	// Publish a generated value to every node of the broker.
+	Publish(value string) error
+	// Messages delivers published values, local and remote, in order.
+	Messages() <-chan Message
+}
@@ -0,0 +1,188 @@
+package broker
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// waitFor polls cond until it holds, failing the test after 5 seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// synced reports whether every link of b is resynced with its peer.
+func synced(b *TCP) func() bool {
+	return func() bool {
+		b.seqLock.Lock()
+		defer b.seqLock.Unlock()
+		for _, l := range b.links {
+			if !l.synced {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestLocalPublishOrder(t *testing.T) {
+	b := NewLocal()
+	if err := b.Start(); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer b.Stop()
+
+	for i := 1; i <= 10; i++ {
+		if err := b.Publish(fmt.Sprintf("%02d", i)); err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+		m := <-b.Messages()
+		if m.Seq != uint64(i) || m.Value != fmt.Sprintf("%02d", i) {
+			t.Errorf("got seq %d value %s, want seq %d", m.Seq, m.Value, i)
+		}
+	}
+}
+
+func TestTCPFanOut(t *testing.T) {
+	addrA, addrB := freeAddr(t), freeAddr(t)
+
+	a := NewTCP(TCPConfig{NodeID: "a", Addr: addrA, Peers: []string{addrB}})
+	b := NewTCP(TCPConfig{NodeID: "b", Addr: addrB, Peers: []string{addrA}})
+	for _, n := range []*TCP{a, b} {
+		if err := n.Start(); err != nil {
+			t.Fatalf("Start error: %v", err)
+		}
+		defer n.Stop()
+	}
+
+	waitFor(t, "the link from a to b", synced(a))
+
+	const count = 50
+	go func() {
+		for i := 1; i <= count; i++ {
+			a.Publish(fmt.Sprintf("%02d", i))
+		}
+	}()
+
+	for _, n := range []*TCP{a, b} {
+		for i := 1; i <= count; i++ {
+			select {
+			case m := <-n.Messages():
+				if m.Seq != uint64(i) || m.Value != fmt.Sprintf("%02d", i) {
+					t.Fatalf("node %s got seq %d value %s, want seq %d", n.cfg.NodeID, m.Seq, m.Value, i)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("node %s timed out waiting for seq %d", n.cfg.NodeID, i)
+			}
+		}
+	}
+}
+
+func TestTCPResync(t *testing.T) {
+	b := NewTCP(TCPConfig{NodeID: "a", Peers: []string{"127.0.0.1:1"}})
+	l := b.links[0]
+	b.resync(l, 0)
+
+	// Fill the queue of the link, the next value makes it lag.
+	for i := 0; i <= linkQueueSize; i++ {
+		go func() { <-b.msgCh }()
+		b.Publish(fmt.Sprint(i))
+	}
+	select {
+	case <-l.lagged:
+	default:
+		t.Fatal("link did not lag with a full queue")
+	}
+	if l.synced {
+		t.Fatal("lagging link still synced")
+	}
+
+	// The peer received up to seq 50, it gets the rest from the history.
+	replay, _ := b.resync(l, 50)
+	if len(replay) != linkQueueSize+1-50 || replay[0].Seq != 51 || len(l.queue) != 0 {
+		t.Fatalf("got %d values from seq %d and %d queued, want the values after seq 50", len(replay), replay[0].Seq, len(l.queue))
+	}
+
+	// A peer that never received a value of this node only gets new ones.
+	if replay, _ := b.resync(l, 0); len(replay) != 0 {
+		t.Fatalf("got %d values, want none for a new peer", len(replay))
+	}
+
+	// A peer behind the history cannot be resynced.
+	b.unsync(l)
+	for i := 0; i < historySize; i++ {
+		go func() { <-b.msgCh }()
+		b.Publish(fmt.Sprint(i))
+	}
+	if replay, _ := b.resync(l, 50); len(replay) != 0 {
+		t.Fatalf("got %d values, want none for a peer behind the history", len(replay))
+	}
+
+	// The wrapped history replays in order from its oldest value.
+	oldest, _ := b.history.oldest()
+	replay, _ = b.resync(l, oldest.Seq-1)
+	if len(replay) != historySize || replay[0].Seq != oldest.Seq || replay[historySize-1].Seq != b.seq {
+		t.Fatalf("got %d values, want the %d kept values in order", len(replay), historySize)
+	}
+	for i := 1; i < len(replay); i++ {
+		if replay[i].Seq != replay[i-1].Seq+1 {
+			t.Fatalf("got seq %d after %d, want the values in order", replay[i].Seq, replay[i-1].Seq)
+		}
+	}
+}
+
+func TestTCPPeerRestart(t *testing.T) {
+	addrA, addrB := freeAddr(t), freeAddr(t)
+
+	a := NewTCP(TCPConfig{NodeID: "a", Addr: addrA, Peers: []string{addrB}})
+	if err := a.Start(); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer a.Stop()
+
+	// Values published while b is down are not queued for it.
+	for i := 1; i <= 20; i++ {
+		a.Publish(fmt.Sprintf("%02d", i))
+		<-a.Messages()
+	}
+
+	b := NewTCP(TCPConfig{NodeID: "b", Addr: addrB})
+	if err := b.Start(); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer b.Stop()
+	waitFor(t, "the link from a to b", synced(a))
+
+	a.Publish("21")
+	select {
+	case m := <-b.Messages():
+		if m.Seq != 21 {
+			t.Fatalf("got seq %d, want 21 without the values published before b started", m.Seq)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for seq 21")
+	}
+
+	// The dedup of b drops values replayed over a new link.
+	if err := b.receive("a", Message{Seq: 21}); err != nil || len(b.msgCh) != 0 {
+		t.Fatalf("got %d messages, want the duplicate dropped", len(b.msgCh))
+	}
+}
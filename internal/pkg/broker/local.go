@@ -0,0 +1,47 @@
+package broker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrStopped = errors.New("broker stopped")
+
+// Local is an in-process broker for a single goapp node.
+type Local struct {
+	msgCh       chan Message  // Delivered messages.
+	seq         uint64        // Last published sequence.
+	seqLock     sync.Mutex    // Lock for seq, keeps delivery in order.
+	quitChannel chan struct{} // Quit.
+}
+
+func NewLocal() *Local {
+	b := Local{}
+	b.msgCh = make(chan Message, 100)
+	b.quitChannel = make(chan struct{})
+	return &b
+}
+
+func (b *Local) Start() error { return nil }
+
+func (b *Local) Stop() { close(b.quitChannel) }
+
+func (b *Local) Publish(value string) error {
+	b.seqLock.Lock()
+	defer b.seqLock.Unlock()
+
+	b.seq++
+	return deliver(b.msgCh, b.quitChannel, Message{Seq: b.seq, Value: value, Time: time.Now()})
+}
+
+func (b *Local) Messages() <-chan Message { return b.msgCh }
+
+func deliver(msgCh chan<- Message, quit <-chan struct{}, m Message) error {
+	select {
+	case msgCh <- m:
+		return nil
+	case <-quit:
+		return ErrStopped
+	}
+}
@@ -0,0 +1,452 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"goapp/internal/pkg/logging"
+)
+
+const (
+	HeartbeatInterval = 500 * time.Millisecond // Ping period on idle peer links.
+	PeerTimeout       = 3 * HeartbeatInterval  // Peer link is dead after this much silence.
+	redialInterval    = 1 * time.Second        // Pause between dial attempts to a peer.
+	linkQueueSize     = 100                    // Frames buffered per peer link.
+	historySize       = 1000                   // Published messages kept to resync peer links.
+)
+
+const (
+	frameHello  = "hello"
+	frameValue  = "value"
+	framePing   = "ping"
+	frameResume = "resume"
+)
+
+// frame is a newline delimited JSON record exchanged between nodes.
+type frame struct {
+	Type    string   `json:"type"`
+	Node    string   `json:"node,omitempty"`
+	Epoch   int64    `json:"epoch,omitempty"` // Start time of the sending node, tells its restarts apart.
+	Seq     uint64   `json:"seq,omitempty"`   // Last value received from the dialing node, in resume frames.
+	Message *Message `json:"message,omitempty"`
+}
+
+type TCPConfig struct {
+	NodeID string   // Node ID announced to peers.
+	Addr   string   // Listen address for peer links.
+	Peers  []string // Listen addresses of the other nodes.
+}
+
+// TCP is a peer-to-peer broker. Every node dials every configured peer and
+// forwards the values it publishes over that link, so values from one
+// publisher reach all nodes in publish order.
+//
+// A peer answers the hello of a link with the sequence of the last value it
+// received from the dialing node, which replays the newer values of its
+// history before forwarding new ones. A link whose queue overflows is closed
+// and resynced the same way rather than skipping values.
+type TCP struct {
+	cfg         TCPConfig
+	epoch       int64                 // Start time of this node.
+	listener    net.Listener          // Peer listener.
+	links       []*link               // Outbound peer links.
+	msgCh       chan Message          // Delivered messages.
+	seq         uint64                // Last published or received sequence.
+	history     *history              // Last published messages.
+	received    map[string]peerCursor // Last value received per peer node ID.
+	seqLock     sync.Mutex            // Lock for seq, history, received and link sync, keeps delivery in order.
+	members     map[string]int        // Live inbound links per peer node ID.
+	membersLock sync.Mutex            // Lock for members.
+	quitChannel chan struct{}         // Quit.
+	running     sync.WaitGroup        // Running.
+}
+
+type link struct {
+	addr   string        // Peer address.
+	queue  chan frame    // Frames waiting to be written.
+	synced bool          // Publish queues values for the peer.
+	lagged chan struct{} // Closed when the queue overflowed.
+}
+
+// history keeps the last published messages to resync peer links, guarded by
+// the seqLock of its broker.
+type history struct {
+	msgs []Message // Ring buffer.
+	next int       // Index of the next write.
+	full bool      // Ring buffer wrapped around.
+}
+
+func newHistory(size int) *history {
+	return &history{msgs: make([]Message, size)}
+}
+
+func (h *history) add(m Message) {
+	h.msgs[h.next] = m
+	h.next = (h.next + 1) % len(h.msgs)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// oldest returns the oldest kept message, false when none is kept.
+func (h *history) oldest() (Message, bool) {
+	if h.full {
+		return h.msgs[h.next], true
+	}
+	if h.next == 0 {
+		return Message{}, false
+	}
+	return h.msgs[0], true
+}
+
+// since returns the kept messages with a sequence greater than seq, oldest
+// first.
+func (h *history) since(seq uint64) []Message {
+	var ordered []Message
+	if h.full {
+		ordered = append(ordered, h.msgs[h.next:]...)
+	}
+	ordered = append(ordered, h.msgs[:h.next]...)
+
+	var msgs []Message
+	for _, m := range ordered {
+		if m.Seq > seq {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// peerCursor is the last value received from a peer node while it ran as
+// epoch.
+type peerCursor struct {
+	epoch int64
+	seq   uint64
+}
+
+func NewTCP(cfg TCPConfig) *TCP {
+	b := TCP{}
+	b.cfg = cfg
+	b.epoch = time.Now().UnixNano()
+	b.msgCh = make(chan Message, 100)
+	b.history = newHistory(historySize)
+	b.received = make(map[string]peerCursor)
+	b.members = make(map[string]int)
+	b.quitChannel = make(chan struct{})
+	for _, addr := range cfg.Peers {
+		b.links = append(b.links, &link{addr: addr, queue: make(chan frame, linkQueueSize)})
+	}
+	return &b
+}
+
+func (b *TCP) Start() error {
+	l, err := net.Listen("tcp", b.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for peers: %w", err)
+	}
+	b.listener = l
+
+	b.running.Add(1)
+	go b.acceptLoop()
+
+	for _, l := range b.links {
+		b.running.Add(1)
+		go b.linkLoop(l)
+	}
+
+	return nil
+}
+
+func (b *TCP) Stop() {
+	close(b.quitChannel)
+	b.listener.Close()
+	b.running.Wait()
+}
+
+func (b *TCP) Publish(value string) error {
+	b.seqLock.Lock()
+	defer b.seqLock.Unlock()
+
+	b.seq++
+	m := Message{Seq: b.seq, Value: value, Time: time.Now()}
+
+	b.history.add(m)
+
+	for _, l := range b.links {
+		if !l.synced {
+			continue
+		}
+		select {
+		case l.queue <- frame{Type: frameValue, Message: &m}:
+		default:
+			// Skipping the value would break the order of the peer, resync
+			// it from the history instead.
+			slog.Warn("peer queue full, resyncing link", "peer", l.addr, "seq", m.Seq)
+			l.synced = false
+			close(l.lagged)
+		}
+	}
+
+	return deliver(b.msgCh, b.quitChannel, m)
+}
+
+func (b *TCP) Messages() <-chan Message { return b.msgCh }
+
+// Members returns the IDs of the peer nodes with a live link to this node.
+func (b *TCP) Members() []string {
+	b.membersLock.Lock()
+	defer b.membersLock.Unlock()
+
+	ids := make([]string, 0, len(b.members))
+	for id := range b.members {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (b *TCP) addMember(id string) {
+	b.membersLock.Lock()
+	defer b.membersLock.Unlock()
+	b.members[id]++
+}
+
+func (b *TCP) removeMember(id string) {
+	b.membersLock.Lock()
+	defer b.membersLock.Unlock()
+	if b.members[id]--; b.members[id] <= 0 {
+		delete(b.members, id)
+	}
+}
+
+// hello records a peer node running as epoch and returns the sequence of
+// the last value received from it, zero after it restarted.
+func (b *TCP) hello(node string, epoch int64) uint64 {
+	b.seqLock.Lock()
+	defer b.seqLock.Unlock()
+
+	c := b.received[node]
+	if c.epoch != epoch {
+		c = peerCursor{epoch: epoch}
+		b.received[node] = c
+	}
+	return c.seq
+}
+
+// receive delivers a value of a peer node, unless it was already delivered
+// over a previous link.
+func (b *TCP) receive(node string, m Message) error {
+	b.seqLock.Lock()
+	defer b.seqLock.Unlock()
+
+	c := b.received[node]
+	if m.Seq <= c.seq {
+		return nil
+	}
+	c.seq = m.Seq
+	b.received[node] = c
+
+	if m.Seq > b.seq {
+		b.seq = m.Seq
+	}
+	return deliver(b.msgCh, b.quitChannel, m)
+}
+
+// resync drops the values queued for a previous connection of a link and
+// returns the values of the history published after seq. The peer gets no
+// replay when it never received a value of this node, or when seq left the
+// history.
+func (b *TCP) resync(l *link, seq uint64) ([]Message, <-chan struct{}) {
+	b.seqLock.Lock()
+	defer b.seqLock.Unlock()
+
+	for len(l.queue) > 0 {
+		<-l.queue
+	}
+	l.synced = true
+	l.lagged = make(chan struct{})
+
+	oldest, ok := b.history.oldest()
+	if seq == 0 || !ok {
+		return nil, l.lagged
+	}
+	if seq+1 < oldest.Seq {
+		slog.Warn("peer is behind the history, values lost", "peer", l.addr, "seq", seq, "oldest", oldest.Seq)
+		return nil, l.lagged
+	}
+	return b.history.since(seq), l.lagged
+}
+
+func (b *TCP) unsync(l *link) {
+	b.seqLock.Lock()
+	defer b.seqLock.Unlock()
+	l.synced = false
+}
+
+func (b *TCP) acceptLoop() {
+	defer b.running.Done()
+
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			select {
+			case <-b.quitChannel:
+				return
+			default:
+			}
+			slog.Error("peer accept error", logging.Err(err))
+			continue
+		}
+
+		b.running.Add(1)
+		go b.servePeer(conn)
+	}
+}
+
+// servePeer reads frames sent by a peer until the link dies or the broker
+// stops.
+func (b *TCP) servePeer(conn net.Conn) {
+	defer b.running.Done()
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-b.quitChannel:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var node string
+	defer func() {
+		if node != "" {
+			b.removeMember(node)
+		}
+	}()
+
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(PeerTimeout))
+
+		var f frame
+		if err := dec.Decode(&f); err != nil {
+			select {
+			case <-b.quitChannel:
+				return
+			default:
+			}
+			if node != "" {
+				slog.Info("peer disconnected", "peer", node, logging.Err(err))
+			}
+			return
+		}
+
+		switch f.Type {
+		case frameHello:
+			if node != "" || f.Node == "" {
+				continue
+			}
+			node = f.Node
+			conn.SetWriteDeadline(time.Now().Add(PeerTimeout))
+			if err := enc.Encode(frame{Type: frameResume, Seq: b.hello(node, f.Epoch)}); err != nil {
+				return
+			}
+			b.addMember(node)
+			slog.Info("peer connected", "peer", node, "remote_addr", conn.RemoteAddr().String())
+		case frameValue:
+			if f.Message == nil || node == "" {
+				continue
+			}
+			if err := b.receive(node, *f.Message); err != nil {
+				return
+			}
+		case framePing:
+		default:
+			slog.Warn("peer sent unknown frame", "peer", node, "type", f.Type)
+		}
+	}
+}
+
+// linkLoop keeps an outbound link to a peer open, redialing when it drops.
+func (b *TCP) linkLoop(l *link) {
+	defer b.running.Done()
+
+	for {
+		var lagged bool
+		conn, err := net.DialTimeout("tcp", l.addr, redialInterval)
+		if err == nil {
+			lagged = b.serveLink(l, conn)
+		}
+
+		wait := redialInterval
+		if lagged {
+			// Resync right away, the peer is alive.
+			wait = 0
+		}
+		select {
+		case <-b.quitChannel:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// serveLink writes the values of a link to a peer until the link dies, the
+// peer lags behind or the broker stops. It returns true when the peer
+// lagged.
+func (b *TCP) serveLink(l *link, conn net.Conn) bool {
+	defer conn.Close()
+	defer b.unsync(l)
+
+	enc := json.NewEncoder(conn)
+	send := func(f frame) error {
+		conn.SetWriteDeadline(time.Now().Add(PeerTimeout))
+		return enc.Encode(f)
+	}
+
+	if err := send(frame{Type: frameHello, Node: b.cfg.NodeID, Epoch: b.epoch}); err != nil {
+		return false
+	}
+
+	var resume frame
+	conn.SetReadDeadline(time.Now().Add(PeerTimeout))
+	if err := json.NewDecoder(conn).Decode(&resume); err != nil || resume.Type != frameResume {
+		slog.Warn("peer did not resume link", "peer", l.addr, logging.Err(err))
+		return false
+	}
+
+	replay, lagged := b.resync(l, resume.Seq)
+	for i := range replay {
+		if err := send(frame{Type: frameValue, Message: &replay[i]}); err != nil {
+			slog.Warn("peer write error", "peer", l.addr, logging.Err(err))
+			return false
+		}
+	}
+
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case f := <-l.queue:
+			err = send(f)
+		case <-ticker.C:
+			err = send(frame{Type: framePing})
+		case <-lagged:
+			return true
+		case <-b.quitChannel:
+			return false
+		}
+		if err != nil {
+			slog.Warn("peer write error", "peer", l.addr, logging.Err(err))
+			return false
+		}
+	}
+}
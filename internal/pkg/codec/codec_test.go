@@ -0,0 +1,103 @@
+package codec
+
+import (
+	"testing"
+)
+
+type message struct {
+	Iteration int    `json:"iteration"`
+	Value     string `json:"value"`
+}
+
+type envelope struct {
+	Version int         `json:"version,omitempty"`
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range All() {
+		t.Run(c.Name(), func(t *testing.T) {
+			in := envelope{Version: 1, Type: "subscribe", ID: "7", Payload: map[string]interface{}{"topic": "values"}}
+			data, err := c.Marshal(in)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+
+			var out envelope
+			if err := c.Unmarshal(data, &out); err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			if out.Version != in.Version || out.Type != in.Type || out.ID != in.ID {
+				t.Errorf("got %+v, want %+v", out, in)
+			}
+			payload, ok := out.Payload.(map[string]interface{})
+			if !ok || payload["topic"] != "values" {
+				t.Errorf("got payload %#v, want topic values", out.Payload)
+			}
+
+			// Zero values without omitempty must survive.
+			data, _ = c.Marshal(message{Iteration: 0, Value: "822876EF10"})
+			var m map[string]interface{}
+			if err := c.Unmarshal(data, &m); err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			if _, ok := m["iteration"]; !ok {
+				t.Errorf("iteration missing from %v", m)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if Lookup("") != JSON {
+		t.Errorf("Lookup(\"\") is not JSON")
+	}
+	for _, name := range Names() {
+		if c := Lookup(name); c == nil || c.Name() != name {
+			t.Errorf("Lookup(%q) = %v", name, c)
+		}
+	}
+	if Lookup("xml") != nil {
+		t.Errorf("Lookup(\"xml\") is not nil")
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	msg := message{Iteration: 12345, Value: "822876EF10"}
+
+	for _, c := range All() {
+		b.Run(c.Name(), func(b *testing.B) {
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := c.Marshal(msg)
+				if err != nil {
+					b.Fatalf("Marshal error: %v", err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/msg")
+		})
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	msg := message{Iteration: 12345, Value: "822876EF10"}
+
+	for _, c := range All() {
+		b.Run(c.Name(), func(b *testing.B) {
+			data, _ := c.Marshal(msg)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var out message
+				if err := c.Unmarshal(data, &out); err != nil {
+					b.Fatalf("Unmarshal error: %v", err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/msg")
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package election
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Membership reports the IDs of the peer nodes that are currently alive.
+type Membership interface {
+	Members() []string
+}
+
+type Config struct {
+	NodeID   string        // ID of this node.
+	Members  Membership    // Live peers, nil for a single node.
+	Interval time.Duration // Period between leader checks.
+	Settle   time.Duration // Time to learn about live peers before the first election.
+}
+
+// Elector picks the node with the lowest ID among the live nodes as leader.
+// Every node runs the same rule on its own view of the cluster, so once the
+// peer links agree exactly one node leads. When the leader dies its peers
+// drop it from their view within the peer timeout and the next node takes
+// over.
+type Elector struct {
+	cfg         Config
+	leader      string         // Current leader ID.
+	elected     bool           // Whether a leader was elected yet.
+	leaderLock  sync.RWMutex   // Lock for leader.
+	changeCh    chan bool      // Leadership changes of this node.
+	quitChannel chan struct{}  // Quit.
+	running     sync.WaitGroup // Running.
+}
+
+func New(cfg Config) *Elector {
+	e := Elector{}
+	e.cfg = cfg
+	e.changeCh = make(chan bool, 1)
+	e.quitChannel = make(chan struct{})
+	return &e
+}
+
+// Start elector, Stop() must be called at the end.
+func (e *Elector) Start() error {
+	e.running.Add(1)
+	go e.mainLoop()
+
+	return nil
+}
+
+func (e *Elector) Stop() {
+	close(e.quitChannel)
+	e.running.Wait()
+}
+
+// Leader returns the ID of the current leader, empty before the first
+// election.
+func (e *Elector) Leader() string {
+	e.leaderLock.RLock()
+	defer e.leaderLock.RUnlock()
+	return e.leader
+}
+
+func (e *Elector) IsLeader() bool { return e.Leader() == e.cfg.NodeID }
+
+// Changes notifies whether this node leads, every time that changes.
+func (e *Elector) Changes() <-chan bool { return e.changeCh }
+
+func (e *Elector) mainLoop() {
+	defer e.running.Done()
+
+	if e.cfg.Members != nil {
+		select {
+		case <-time.After(e.cfg.Settle):
+		case <-e.quitChannel:
+			return
+		}
+	}
+
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		e.elect()
+
+		select {
+		case <-ticker.C:
+		case <-e.quitChannel:
+			return
+		}
+	}
+}
+
+func (e *Elector) elect() {
+	leader := e.cfg.NodeID
+	if e.cfg.Members != nil {
+		for _, id := range e.cfg.Members.Members() {
+			if id < leader {
+				leader = id
+			}
+		}
+	}
+
+	e.leaderLock.Lock()
+	previous, elected := e.leader, e.elected
+	e.leader, e.elected = leader, true
+	e.leaderLock.Unlock()
+
+	if elected && leader == previous {
+		return
+	}
+
+	if leader == e.cfg.NodeID {
+		slog.Info("node is now the leader", "node", e.cfg.NodeID)
+	} else {
+		slog.Info("node follows leader", "node", e.cfg.NodeID, "leader", leader)
+	}
+
+	isLeader := leader == e.cfg.NodeID
+	if elected && isLeader == (previous == e.cfg.NodeID) {
+		return
+	}
+
+	// Keep only the latest state for a slow reader.
+	select {
+	case <-e.changeCh:
+	default:
+	}
+	e.changeCh <- isLeader
+}
@@ -0,0 +1,69 @@
+package election
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type staticMembers struct {
+	ids []string
+	mu  sync.Mutex
+}
+
+func (m *staticMembers) Members() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.ids...)
+}
+
+func (m *staticMembers) set(ids ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ids = ids
+}
+
+func waitChange(t *testing.T, e *Elector, want bool) {
+	t.Helper()
+	select {
+	case got := <-e.Changes():
+		if got != want {
+			t.Fatalf("leadership = %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for leadership %v", want)
+	}
+}
+
+func TestSingleNodeLeads(t *testing.T) {
+	e := New(Config{NodeID: "a", Interval: 10 * time.Millisecond})
+	e.Start()
+	defer e.Stop()
+
+	waitChange(t, e, true)
+	if !e.IsLeader() {
+		t.Errorf("single node is not the leader")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	members := &staticMembers{}
+	members.set("a", "c")
+
+	e := New(Config{NodeID: "b", Members: members, Interval: 10 * time.Millisecond})
+	e.Start()
+	defer e.Stop()
+
+	waitChange(t, e, false)
+	if got := e.Leader(); got != "a" {
+		t.Errorf("Leader() = %s, want a", got)
+	}
+
+	// Leader dies.
+	members.set("c")
+	waitChange(t, e, true)
+
+	// Leader comes back.
+	members.set("a", "c")
+	waitChange(t, e, false)
+}
@@ -0,0 +1,228 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: goapp.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	GoApp_Subscribe_FullMethodName = "/goapp.v1.GoApp/Subscribe"
+	GoApp_Reset_FullMethodName     = "/goapp.v1.GoApp/Reset"
+	GoApp_GetStats_FullMethodName  = "/goapp.v1.GoApp/GetStats"
+)
+
+// GoAppClient is the client API for GoApp service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GoApp streams the generated values. Every Subscribe call is a session of
+// its own, counting the values it receives like a WebSocket session.
+type GoAppClient interface {
+	// Subscribe streams the values of a new session. The session ID is sent in
+	// the goapp-session-id response header.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (GoApp_SubscribeClient, error)
+	// Reset resets the counter of a session to zero.
+	Reset(ctx context.Context, in *ResetRequest, opts ...grpc.CallOption) (*ResetResponse, error)
+	// GetStats returns the statistics of one or all sessions.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
+}
+
+type goAppClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGoAppClient(cc grpc.ClientConnInterface) GoAppClient {
+	return &goAppClient{cc}
+}
+
+func (c *goAppClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (GoApp_SubscribeClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GoApp_ServiceDesc.Streams[0], GoApp_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goAppSubscribeClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GoApp_SubscribeClient interface {
+	Recv() (*Value, error)
+	grpc.ClientStream
+}
+
+type goAppSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *goAppSubscribeClient) Recv() (*Value, error) {
+	m := new(Value)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *goAppClient) Reset(ctx context.Context, in *ResetRequest, opts ...grpc.CallOption) (*ResetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResetResponse)
+	err := c.cc.Invoke(ctx, GoApp_Reset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goAppClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, GoApp_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GoAppServer is the server API for GoApp service.
+// All implementations must embed UnimplementedGoAppServer
+// for forward compatibility
+//
+// GoApp streams the generated values. Every Subscribe call is a session of
+// its own, counting the values it receives like a WebSocket session.
+type GoAppServer interface {
+	// Subscribe streams the values of a new session. The session ID is sent in
+	// the goapp-session-id response header.
+	Subscribe(*SubscribeRequest, GoApp_SubscribeServer) error
+	// Reset resets the counter of a session to zero.
+	Reset(context.Context, *ResetRequest) (*ResetResponse, error)
+	// GetStats returns the statistics of one or all sessions.
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	mustEmbedUnimplementedGoAppServer()
+}
+
+// UnimplementedGoAppServer must be embedded to have forward compatible implementations.
+type UnimplementedGoAppServer struct {
+}
+
+func (UnimplementedGoAppServer) Subscribe(*SubscribeRequest, GoApp_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedGoAppServer) Reset(context.Context, *ResetRequest) (*ResetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reset not implemented")
+}
+func (UnimplementedGoAppServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedGoAppServer) mustEmbedUnimplementedGoAppServer() {}
+
+// UnsafeGoAppServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GoAppServer will
+// result in compilation errors.
+type UnsafeGoAppServer interface {
+	mustEmbedUnimplementedGoAppServer()
+}
+
+func RegisterGoAppServer(s grpc.ServiceRegistrar, srv GoAppServer) {
+	s.RegisterService(&GoApp_ServiceDesc, srv)
+}
+
+func _GoApp_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoAppServer).Subscribe(m, &goAppSubscribeServer{ServerStream: stream})
+}
+
+type GoApp_SubscribeServer interface {
+	Send(*Value) error
+	grpc.ServerStream
+}
+
+type goAppSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *goAppSubscribeServer) Send(m *Value) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GoApp_Reset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoAppServer).Reset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoApp_Reset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoAppServer).Reset(ctx, req.(*ResetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoApp_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoAppServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GoApp_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoAppServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GoApp_ServiceDesc is the grpc.ServiceDesc for GoApp service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GoApp_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "goapp.v1.GoApp",
+	HandlerType: (*GoAppServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Reset",
+			Handler:    _GoApp_Reset_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _GoApp_GetStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _GoApp_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "goapp.proto",
+}
@@ -0,0 +1,159 @@
+// Package grpcsrv serves the value stream over gRPC, next to the HTTP server
+// and sharing its sessions and statistics.
+package grpcsrv
+
+//go:generate protoc -I ../../../api/proto --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative goapp.proto
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"goapp/internal/pkg/grpcsrv/pb"
+	"goapp/internal/pkg/httpsrv"
+	"goapp/internal/pkg/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// transport is the session transport reported in statistics.
+const transport = "grpc"
+
+// SessionHeader is the response header carrying the ID of a Subscribe session.
+const SessionHeader = "goapp-session-id"
+
+type Config struct {
+	Addr string // gRPC listen address, empty disables the server.
+}
+
+type Server struct {
+	pb.UnimplementedGoAppServer
+
+	cfg         Config
+	hub         *httpsrv.Server
+	server      *grpc.Server
+	quitChannel chan struct{}
+	running     sync.WaitGroup
+}
+
+func New(cfg Config, hub *httpsrv.Server) *Server {
+	return &Server{
+		cfg:         cfg,
+		hub:         hub,
+		quitChannel: make(chan struct{}),
+	}
+}
+
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.cfg.Addr, err)
+	}
+
+	s.serve(lis)
+	return nil
+}
+
+func (s *Server) serve(lis net.Listener) {
+	s.server = grpc.NewServer()
+	pb.RegisterGoAppServer(s.server, s)
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		if err := s.server.Serve(lis); err != nil {
+			slog.Error("gRPC server error", logging.Err(err))
+		}
+	}()
+}
+
+func (s *Server) Stop() {
+	// End the streams first, GracefulStop waits for them.
+	close(s.quitChannel)
+	s.server.GracefulStop()
+	s.running.Wait()
+}
+
+func (s *Server) Subscribe(_ *pb.SubscribeRequest, stream pb.GoApp_SubscribeServer) error {
+	var remoteAddr string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	sess, err := s.hub.OpenSession(transport, remoteAddr)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer sess.Close()
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok && len(md.Get("user-agent")) > 0 {
+		sess.SetUserAgent(md.Get("user-agent")[0])
+	}
+
+	if err := stream.SendHeader(metadata.Pairs(SessionHeader, sess.ID())); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case counter := <-sess.Values():
+			v := &pb.Value{Iteration: uint64(counter.Iteration), Value: counter.Value, Seq: counter.Seq}
+			if err := stream.Send(v); err != nil {
+				sess.SetCloseReason("write failed")
+				return err
+			}
+			sess.Sent(proto.Size(v))
+		case <-stream.Context().Done():
+			sess.SetCloseReason("client disconnected")
+			return nil
+		case <-s.quitChannel:
+			sess.SetCloseReason("server stopped")
+			return status.Error(codes.Unavailable, "server is stopping")
+		}
+	}
+}
+
+func (s *Server) Reset(_ context.Context, req *pb.ResetRequest) (*pb.ResetResponse, error) {
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing session ID")
+	}
+	if !s.hub.ResetSession(req.GetSessionId()) {
+		return nil, status.Errorf(codes.NotFound, "unknown session %q", req.GetSessionId())
+	}
+	return &pb.ResetResponse{}, nil
+}
+
+func (s *Server) GetStats(_ context.Context, req *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
+	if req.GetSessionId() == "" {
+		resp := &pb.GetStatsResponse{}
+		for _, st := range s.hub.AllSessionStats() {
+			resp.Sessions = append(resp.Sessions, toProto(st))
+		}
+		return resp, nil
+	}
+
+	st, exists := s.hub.SessionStats(req.GetSessionId())
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "unknown session %q", req.GetSessionId())
+	}
+	return &pb.GetStatsResponse{Sessions: []*pb.SessionStats{toProto(st)}}, nil
+}
+
+func toProto(st httpsrv.SessionStats) *pb.SessionStats {
+	return &pb.SessionStats{
+		SessionId:  st.ID,
+		Transport:  st.Transport,
+		RemoteAddr: st.RemoteAddr,
+		Started:    timestamppb.New(st.Started),
+		Sent:       st.Sent,
+		RawBytes:   st.RawBytes,
+		WireBytes:  st.WireBytes,
+	}
+}
@@ -0,0 +1,110 @@
+package grpcsrv
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/grpcsrv/pb"
+	"goapp/internal/pkg/httpsrv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSubscribe(t *testing.T) {
+	b := broker.NewLocal()
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+
+	cfg := httpsrv.DefaultConfig()
+	cfg.Addr = "127.0.0.1:0"
+	hub := httpsrv.New(cfg, b)
+	if err := hub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Stop()
+
+	lis := bufconn.Listen(1 << 16)
+	s := New(Config{}, hub)
+	s.serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewGoAppClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &pb.SubscribeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := metadata.MD(header).Get(SessionHeader)
+	if len(id) != 1 {
+		t.Fatalf("missing %s header", SessionHeader)
+	}
+
+	recv := func(want uint64, value string) {
+		t.Helper()
+		v, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Iteration != want || v.Value != value {
+			t.Fatalf("got %d %q, want %d %q", v.Iteration, v.Value, want, value)
+		}
+	}
+
+	for _, value := range []string{"A1", "B2"} {
+		if err := b.Publish(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv(1, "A1")
+	recv(2, "B2")
+
+	if _, err := client.Reset(ctx, &pb.ResetRequest{SessionId: id[0]}); err != nil {
+		t.Fatal(err)
+	}
+	recv(0, "B2")
+
+	// The server counts a value after sending it.
+	var got *pb.SessionStats
+	for i := 0; i < 50; i++ {
+		stats, err := client.GetStats(ctx, &pb.GetStatsRequest{SessionId: id[0]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = stats.Sessions[0]; got.Sent == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Transport != transport || got.Sent != 3 || got.WireBytes == 0 {
+		t.Fatalf("unexpected stats %v", got)
+	}
+
+	_, err = client.Reset(ctx, &pb.ResetRequest{SessionId: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("got %v, want NotFound", err)
+	}
+}
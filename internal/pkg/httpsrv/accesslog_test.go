@@ -0,0 +1,56 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/logging"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(logging.Config{Format: logging.FormatJSON, Level: "info"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	s := New(DefaultConfig(), broker.NewLocal())
+	h := requestIDMiddleware(accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.error(w, http.StatusNotFound, errors.New("no such thing"))
+	})))
+
+	for _, tc := range []struct {
+		header string
+		valid  bool
+	}{
+		{"abc-123", true},
+		{"bad id\n", false},
+	} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/goapp/x?y=1", nil)
+		req.Header.Set(requestIDHeader, tc.header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		id := w.Header().Get(requestIDHeader)
+		if (id == tc.header) != tc.valid || id == "" {
+			t.Fatalf("got request ID %q for %q", id, tc.header)
+		}
+
+		var line map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatalf("got %q, want a single JSON line: %v", buf.String(), err)
+		}
+		if line[logging.KeyRequestID] != id || line["status"] != float64(404) || line["path"] != "/goapp/x?y=1" || line[logging.KeyError] != "no such thing" {
+			t.Fatalf("got %v, want the request line of %s", line, id)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package httpsrv
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+)
+
+// adminRealm is the basic authentication realm of the admin endpoints.
+const adminRealm = "goapp admin"
+
+// adminOnly serves requests carrying the admin credentials with handlerFunc.
+// Admin endpoints are disabled when no admin password is configured.
+func (s *Server) adminOnly(handlerFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return s.adminOr(func(*http.Request) bool { return false }, handlerFunc)
+}
+
+// adminOrDashboard serves requests carrying the admin credentials or the feed
+// token cookie of the dashboard page with handlerFunc, for the dashboard feed
+// the browser connects to without the credentials.
+func (s *Server) adminOrDashboard(handlerFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return s.adminOr(s.validDashboardToken, handlerFunc)
+}
+
+// adminOr serves requests carrying the admin credentials, or allowed, with
+// handlerFunc.
+func (s *Server) adminOr(allowed func(*http.Request) bool, handlerFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.AdminEnabled() {
+			s.error(w, http.StatusForbidden, fmt.Errorf("admin endpoints are disabled"))
+			return
+		}
+		if !s.isAdmin(r) && !allowed(r) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", adminRealm))
+			s.error(w, http.StatusUnauthorized, fmt.Errorf("invalid admin credentials from %s", r.RemoteAddr))
+			return
+		}
+		handlerFunc(w, r)
+	}
+}
+
+// unauthenticated serves every request with handlerFunc, for the admin
+// listener, which is reachable by admins only.
+func unauthenticated(handlerFunc func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return handlerFunc
+}
+
+// AdminEnabled reports whether an admin password is configured.
+func (s *Server) AdminEnabled() bool {
+	return s.cfg.AdminPassword != ""
+}
+
+// isAdmin checks the basic authentication credentials of r against the admin
+// user and password, it is always false when no admin password is configured.
+func (s *Server) isAdmin(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok || !s.AdminEnabled() {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.cfg.AdminUser)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.cfg.AdminPassword)) == 1
+	return userOK && passwordOK
+}
@@ -0,0 +1,94 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCompressionLevel(t *testing.T) {
+	for _, level := range []int{-3, 10} {
+		cfg := DefaultConfig()
+		cfg.CompressionLevel = level
+		if err := New(cfg, broker.NewLocal()).Start(); err == nil {
+			t.Fatalf("started with compression level %d", level)
+		}
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Compression = true
+	s := New(cfg, broker.NewLocal())
+	srv := httptest.NewServer(http.HandlerFunc(s.handlerWebSocket))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, resp, err := dialer.Dial(url, http.Header{"Origin": {"http://localhost:8080"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("got extensions %q, want permessage-deflate", ext)
+	}
+
+	var sess *session
+	deadline := time.Now().Add(5 * time.Second)
+	for sess == nil || sess.controller() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the session")
+		}
+		time.Sleep(10 * time.Millisecond)
+		s.sessionsLock.RLock()
+		for _, ss := range s.sessions {
+			sess = ss
+		}
+		s.sessionsLock.RUnlock()
+	}
+
+	// notify sends a notice and returns the raw and wire bytes it added to
+	// the session stats.
+	var raw, wire int64
+	notify := func(text string) (int64, int64) {
+		t.Helper()
+		if !sess.controller().notify(notice{typ: msgNotice, payload: noticePayload{Text: text}}) {
+			t.Fatal("notice not queued")
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := conn.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+		// The stats are updated once the write returned.
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			st := s.AllSessionStats()[0]
+			if st.RawBytes != raw {
+				dr, dw := st.RawBytes-raw, st.WireBytes-wire
+				raw, wire = st.RawBytes, st.WireBytes
+				return dr, dw
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the stats")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Below the threshold the message is written as is, after the 2 bytes
+	// frame header.
+	if r, w := notify("short"); r >= int64(cfg.CompressionMin) || w != r+2 {
+		t.Fatalf("got raw %d wire %d, want an uncompressed message below %d bytes", r, w, cfg.CompressionMin)
+	}
+
+	if r, w := notify(strings.Repeat("compressible ", 100)); r < int64(cfg.CompressionMin) || w >= r/4 {
+		t.Fatalf("got raw %d wire %d, want a compressed message", r, w)
+	}
+}
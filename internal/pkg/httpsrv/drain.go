@@ -0,0 +1,82 @@
+package httpsrv
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// drainReconnectDelay is the reconnect hint sent to drained clients.
+const drainReconnectDelay = time.Second
+
+// drainReason is the close reason of drained WebSocket sessions.
+var drainReason = fmt.Sprintf("server shutting down, reconnect in %s", drainReconnectDelay)
+
+// beginWebSocket registers a WebSocket connection to drain on shutdown. It
+// returns false when the server is draining, endWebSocket() must be called
+// at the end otherwise.
+func (s *Server) beginWebSocket() bool {
+	s.drainLock.Lock()
+	defer s.drainLock.Unlock()
+
+	if s.draining {
+		return false
+	}
+	s.webSockets.Add(1)
+	s.webSocketCount++
+	return true
+}
+
+func (s *Server) endWebSocket() {
+	s.drainLock.Lock()
+	s.webSocketCount--
+	s.drainLock.Unlock()
+	s.webSockets.Done()
+}
+
+func (s *Server) isDraining() bool {
+	s.drainLock.Lock()
+	defer s.drainLock.Unlock()
+	return s.draining
+}
+
+// drain stops accepting sessions and asks the WebSocket clients to close with
+// 1001 (going away), waiting up to the drain timeout for them to do so.
+// Sessions still open at the deadline are closed when the server stops.
+func (s *Server) drain() {
+	s.drainLock.Lock()
+	s.draining = true
+	close(s.drainChannel)
+	live := s.webSocketCount
+	s.drainLock.Unlock()
+
+	if live == 0 {
+		return
+	}
+	slog.Info("draining websocket sessions", "sessions", live)
+
+	done := make(chan struct{})
+	go func() {
+		s.webSockets.Wait()
+		close(done)
+	}()
+
+	start := time.Now()
+	select {
+	case <-done:
+		slog.Info("drained websocket sessions", "sessions", live, "duration", time.Since(start).Round(time.Millisecond))
+	case <-time.After(s.cfg.DrainTimeout):
+		s.drainLock.Lock()
+		left := s.webSocketCount
+		s.drainLock.Unlock()
+		slog.Warn("drain timeout, closing websocket sessions", "left", left, "sessions", live)
+	}
+}
+
+// closeGoingAway sends the drain close frame to a WebSocket client.
+func closeGoingAway(conn *websocket.Conn) error {
+	return conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, drainReason), time.Now().Add(time.Second))
+}
@@ -0,0 +1,56 @@
+package httpsrv
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDrain(t *testing.T) {
+	s := New(DefaultConfig(), broker.NewLocal())
+	srv := httptest.NewServer(http.HandlerFunc(s.handlerWebSocket))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	header := http.Header{"Origin": {"http://localhost:8080"}}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for len(s.AllSessionStats()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.drain()
+		close(drained)
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway || closeErr.Text != drainReason {
+		t.Fatalf("got %v, want close 1001 %q", err, drainReason)
+	}
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("drain did not end after the client closed")
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, header); err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want 503 while draining", err)
+	}
+}
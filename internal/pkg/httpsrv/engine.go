@@ -0,0 +1,891 @@
+package httpsrv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"goapp/internal/pkg/codec"
+	"goapp/internal/pkg/logging"
+	"goapp/internal/pkg/metrics"
+	"goapp/internal/pkg/watcher"
+
+	"github.com/gobwas/ws"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket engines.
+const (
+	EngineGoroutine = "goroutine" // Handler, reader, writer and watcher goroutines per session.
+	EngineEpoll     = "epoll"     // Sessions served from an epoll loop by a worker pool, Linux only.
+)
+
+const (
+	epollReadBuffer  = 32 * 1024 // Bytes read at once by a worker.
+	epollReadMax     = 4         // Reads of a connection per task, before the others get a turn.
+	epollWaitTimeout = 100       // Milliseconds between checks of the server context by the poller.
+)
+
+// startEngine starts the WebSocket engine of the configuration.
+func (s *Server) startEngine() error {
+	switch s.cfg.Engine {
+	case "", EngineGoroutine:
+		return nil
+	case EngineEpoll:
+	default:
+		return fmt.Errorf("unknown websocket engine %q", s.cfg.Engine)
+	}
+
+	if s.cfg.Compression {
+		return fmt.Errorf("websocket compression is not supported by the %s engine", EngineEpoll)
+	}
+
+	p, err := newPoller()
+	if err != nil {
+		return err
+	}
+
+	workers := s.cfg.EngineWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	s.epoll = newEpollEngine(s, p)
+	s.epoll.start(workers)
+	return nil
+}
+
+// epollEngine serves WebSocket sessions without goroutines of their own. A
+// poller reports the readable and writable connections, a pool of workers
+// reads their frames and writes their outbound queues, and a sweeper sends
+// the pings, heartbeats and drain close frames of all connections.
+//
+// Workers never wait on a connection: reads and writes are non-blocking, a
+// partial frame is kept until the rest arrives and the bytes a full socket
+// did not take are written once the poller reports it writable.
+type epollEngine struct {
+	s         *Server
+	poller    *poller
+	conns     map[int]*epollConn // Connections by file descriptor.
+	gen       uint32             // Generation of the last connection added.
+	stopped   bool               // No connections are added.
+	connsLock sync.Mutex
+	tasks     []epollTask // Pending work of the workers.
+	tasksLock sync.Mutex
+	tasksCond *sync.Cond
+	swept     chan struct{} // Closed when the sweeper closed all connections.
+	timeLimit time.Duration // Lifetime of a session.
+}
+
+// epollTask is a read of the available frames or a write of the queued
+// frames.
+type epollTask struct {
+	c     *epollConn
+	write bool
+}
+
+func newEpollEngine(s *Server, p *poller) *epollEngine {
+	e := &epollEngine{
+		s:         s,
+		poller:    p,
+		conns:     make(map[int]*epollConn),
+		swept:     make(chan struct{}),
+		timeLimit: wsTimeLimit,
+	}
+	e.tasksCond = sync.NewCond(&e.tasksLock)
+	return e
+}
+
+// start runs the poller, the sweeper and the workers until the server stops.
+func (e *epollEngine) start(workers int) {
+	e.s.running.Add(2 + workers)
+	go e.pollLoop()
+	go e.sweepLoop()
+	for i := 0; i < workers; i++ {
+		go e.workLoop()
+	}
+}
+
+func (e *epollEngine) pollLoop() {
+	defer e.s.running.Done()
+
+	for e.s.ctx.Err() == nil {
+		if err := e.poller.wait(epollWaitTimeout, e.ready); err != nil {
+			slog.Error("epoll wait error", logging.Err(err))
+			break
+		}
+	}
+
+	<-e.swept
+	e.poller.close()
+}
+
+// ready queues the read or the write connection fd waits for, unless it was
+// closed and the descriptor reused by a connection of another generation.
+func (e *epollEngine) ready(fd int, gen uint32, events uint32) {
+	e.connsLock.Lock()
+	c := e.conns[fd]
+	e.connsLock.Unlock()
+
+	if c == nil || c.gen != gen {
+		return
+	}
+	read, write := c.fired(events)
+	if read {
+		e.submit(epollTask{c: c})
+	}
+	if write {
+		e.submit(epollTask{c: c, write: true})
+	}
+}
+
+func (e *epollEngine) sweepLoop() {
+	defer e.s.running.Done()
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	var heartbeatC <-chan time.Time
+	if e.s.cfg.HeartbeatInterval > 0 {
+		heartbeatTicker := time.NewTicker(e.s.cfg.HeartbeatInterval)
+		defer heartbeatTicker.Stop()
+		heartbeatC = heartbeatTicker.C
+	}
+
+	drainCh := e.s.drainChannel
+	for {
+		select {
+		case <-e.s.ctx.Done():
+			e.connsLock.Lock()
+			e.stopped = true
+			e.connsLock.Unlock()
+
+			for _, c := range e.list() {
+				e.s.setCloseStats(c.sess.id(), websocket.CloseAbnormalClosure, "server stopped")
+				c.close()
+			}
+			close(e.swept)
+
+			e.tasksLock.Lock()
+			e.tasksCond.Broadcast()
+			e.tasksLock.Unlock()
+			return
+		case <-drainCh:
+			drainCh = nil
+			data := websocket.FormatCloseMessage(websocket.CloseGoingAway, drainReason)
+			for _, c := range e.list() {
+				c.sendClose(data)
+			}
+		case <-ticker.C:
+			now := time.Now()
+			idle := now.Add(-wsPongWait).UnixNano()
+			stalled := now.Add(-wsWriteWait).UnixNano()
+			for _, c := range e.list() {
+				if c.lastRead.Load() < idle {
+					e.s.setCloseStats(c.sess.id(), websocket.CloseAbnormalClosure, "idle timeout")
+					c.close()
+					continue
+				}
+				if blocked := c.blocked.Load(); blocked != 0 && blocked < stalled {
+					e.s.setCloseStats(c.sess.id(), websocket.CloseAbnormalClosure, "write timeout")
+					c.close()
+					continue
+				}
+				c.queue(prioControl, outFrame{messageType: websocket.PingMessage})
+			}
+		case <-heartbeatC:
+			for _, c := range e.list() {
+				c.queue(prioControl, heartbeatFrame(c.sess, c.rpc))
+			}
+		}
+	}
+}
+
+func (e *epollEngine) workLoop() {
+	defer e.s.running.Done()
+
+	buf := make([]byte, epollReadBuffer)
+	for {
+		t, ok := e.next()
+		if !ok {
+			return
+		}
+		if t.write {
+			t.c.flush()
+		} else {
+			t.c.read(buf)
+		}
+	}
+}
+
+func (e *epollEngine) submit(t epollTask) {
+	e.tasksLock.Lock()
+	e.tasks = append(e.tasks, t)
+	e.tasksLock.Unlock()
+	e.tasksCond.Signal()
+}
+
+// next returns the next task, false when the server stopped and no task is
+// left.
+func (e *epollEngine) next() (epollTask, bool) {
+	e.tasksLock.Lock()
+	defer e.tasksLock.Unlock()
+
+	for len(e.tasks) == 0 {
+		if e.s.ctx.Err() != nil {
+			return epollTask{}, false
+		}
+		e.tasksCond.Wait()
+	}
+	t := e.tasks[0]
+	e.tasks[0] = epollTask{}
+	e.tasks = e.tasks[1:]
+	return t, true
+}
+
+func (e *epollEngine) list() []*epollConn {
+	e.connsLock.Lock()
+	defer e.connsLock.Unlock()
+
+	conns := make([]*epollConn, 0, len(e.conns))
+	for _, c := range e.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// add starts serving an upgraded connection. Frame bytes already read with
+// the handshake in br are handled before the connection is read.
+func (e *epollEngine) add(conn net.Conn, raw syscall.RawConn, fd int, br *bufio.Reader, sess *session, rpc bool) {
+	c := &epollConn{
+		e:    e,
+		conn: conn,
+		raw:  raw,
+		fd:   fd,
+		sess: sess,
+		rpc:  rpc,
+		out:  newOutQueue(),
+	}
+	if n := br.Buffered(); n > 0 {
+		c.in = make([]byte, n)
+		io.ReadFull(br, c.in)
+	}
+	c.out.onDrop = func() { e.s.addDropStats(sess.id()) }
+	sess.control.Store(c)
+	c.lastRead.Store(time.Now().UnixNano())
+	sess.deliver = func(counter watcher.Counter) {
+		if sess.wantsValue(counter.Value) {
+			c.queue(prioValue, valueFrame(counter, rpc))
+		}
+	}
+
+	e.connsLock.Lock()
+	if e.stopped {
+		e.connsLock.Unlock()
+		conn.Close()
+		e.s.endWebSocket()
+		return
+	}
+	e.gen++
+	c.gen = e.gen
+	e.conns[fd] = c
+	e.s.addSession(sess)
+	c.limit = time.AfterFunc(e.timeLimit, func() {
+		e.s.setCloseStats(sess.id(), websocket.CloseAbnormalClosure, "session time limit")
+		c.close()
+	})
+	e.connsLock.Unlock()
+
+	if len(c.in) > 0 {
+		e.submit(epollTask{c: c})
+		return
+	}
+	c.waitReadable()
+}
+
+// forget removes a closing connection.
+func (e *epollEngine) forget(c *epollConn) {
+	e.connsLock.Lock()
+	defer e.connsLock.Unlock()
+
+	if e.conns[c.fd] == c {
+		delete(e.conns, c.fd)
+	}
+}
+
+// epollConn is a WebSocket connection of the epoll engine. One worker at a
+// time reads it, the poller reports it again once armed after a read, and
+// one worker at a time writes its outbound queue.
+type epollConn struct {
+	e           *epollEngine
+	conn        net.Conn
+	raw         syscall.RawConn // Non-blocking reads and writes of conn.
+	fd          int
+	gen         uint32 // Tells the connection apart from later ones reusing fd.
+	sess        *session
+	rpc         bool // JSON-RPC subprotocol.
+	out         *outQueue
+	in          []byte       // Bytes read and not handled yet, the start of a frame.
+	skip        int64        // Payload bytes left of a frame too big to handle.
+	message     []byte       // Fragments of the message being read.
+	inMsg       bool         // A fragmented message is being read.
+	lastRead    atomic.Int64 // Unix nanoseconds of the last frame read.
+	wbuf        []byte       // Bytes of wframe the socket did not take yet.
+	wframe      outFrame     // Frame being written.
+	wsize       int64        // Message bytes of wframe, before framing.
+	wstart      time.Time    // Start of the write of wframe.
+	blocked     atomic.Int64 // Unix nanoseconds since the socket is full, 0 when it is not.
+	writing     atomic.Bool  // A worker is writing the queued frames.
+	closeQueued atomic.Bool  // A close frame is queued.
+	closeSent   atomic.Bool  // A close frame was written, nothing is written after it.
+	closing     atomic.Bool  // The connection closes once the close frame is written.
+	limit       *time.Timer  // Closes the connection at the session time limit.
+	wantRead    bool         // Armed for reads.
+	wantWrite   bool         // Armed for writes.
+	armed       bool         // Added to the poller.
+	closed      bool
+	mu          sync.Mutex // Lock for wantRead, wantWrite, armed and closed.
+}
+
+// waitReadable arms the connection for the next read.
+func (c *epollConn) waitReadable() {
+	c.mu.Lock()
+	c.wantRead = true
+	err := c.arm()
+	c.mu.Unlock()
+
+	if err != nil {
+		c.sess.log.Error("epoll arm error", logging.Err(err))
+		c.close()
+	}
+}
+
+// waitWritable arms the connection for the rest of a short write.
+func (c *epollConn) waitWritable() {
+	c.mu.Lock()
+	c.wantWrite = true
+	err := c.arm()
+	c.mu.Unlock()
+
+	if err != nil {
+		c.sess.log.Error("epoll arm error", logging.Err(err))
+		c.close()
+	}
+}
+
+// arm updates the events of the connection in the poller, c.mu must be held.
+func (c *epollConn) arm() error {
+	if c.closed {
+		return nil
+	}
+
+	var events uint32
+	if c.wantRead {
+		events |= pollRead
+	}
+	if c.wantWrite {
+		events |= pollWrite
+	}
+	if events == 0 {
+		// The one-shot event already disabled the connection.
+		return nil
+	}
+
+	if c.armed {
+		return c.e.poller.rearm(c.fd, c.gen, events)
+	}
+	err := c.e.poller.add(c.fd, c.gen, events)
+	c.armed = err == nil
+	return err
+}
+
+// fired returns whether the events reported by the poller end the wait for a
+// read and a write. The one-shot event disabled the connection, it is armed
+// again for the wait left.
+func (c *epollConn) fired(events uint32) (read, write bool) {
+	c.mu.Lock()
+	read = c.wantRead && events&(pollRead|pollFailed) != 0
+	write = c.wantWrite && events&(pollWrite|pollFailed) != 0
+	if read {
+		c.wantRead = false
+	}
+	if write {
+		c.wantWrite = false
+	}
+	err := c.arm()
+	c.mu.Unlock()
+
+	if err != nil {
+		c.sess.log.Error("epoll arm error", logging.Err(err))
+		c.close()
+		return false, false
+	}
+	return read, write
+}
+
+// read handles the frames of the readable connection, reading without
+// waiting into buf. The connection is armed again unless it stops reading.
+func (c *epollConn) read(buf []byte) {
+	// Bytes read with the handshake.
+	if len(c.in) > 0 && !c.consume(nil) {
+		return
+	}
+
+	for i := 0; i < epollReadMax; i++ {
+		var n int
+		var rerr error
+		err := c.raw.Read(func(fd uintptr) bool {
+			n, rerr = syscall.Read(int(fd), buf)
+			return true
+		})
+		if err == nil {
+			err = rerr
+		}
+
+		switch {
+		case errors.Is(err, syscall.EAGAIN):
+			c.waitReadable()
+			return
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case err != nil:
+			c.readError(err)
+			return
+		case n == 0:
+			c.readError(io.EOF)
+			return
+		}
+
+		if !c.consume(buf[:n]) {
+			return
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	c.waitReadable()
+}
+
+// consume handles the complete frames of the kept bytes followed by data,
+// and keeps the start of the next frame. It returns false once the
+// connection stops reading.
+func (c *epollConn) consume(data []byte) bool {
+	if c.skip > 0 {
+		n := min(c.skip, int64(len(data)))
+		c.skip -= n
+		data = data[n:]
+	}
+
+	b := data
+	if len(c.in) > 0 {
+		c.in = append(c.in, data...)
+		b = c.in
+	}
+
+	for len(b) > 0 {
+		r := bytes.NewReader(b)
+		h, err := ws.ReadHeader(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			c.readError(err)
+			return false
+		}
+		n := int64(len(b) - r.Len())
+
+		if h.Length > wsReadLimit || int64(len(c.message))+h.Length > wsReadLimit {
+			c.fail(ws.StatusMessageTooBig, "message too big")
+			// Skipped while waiting for the client to answer the close frame.
+			skip := min(h.Length, int64(len(b))-n)
+			c.skip = h.Length - skip
+			b = b[n+skip:]
+			continue
+		}
+		if int64(len(b))-n < h.Length {
+			break
+		}
+
+		payload := make([]byte, h.Length)
+		copy(payload, b[n:])
+		b = b[n+h.Length:]
+		if !c.handleFrame(h, payload) {
+			c.in = nil
+			return false
+		}
+	}
+
+	// The kept bytes are copied, the buffer of data belongs to the worker.
+	c.in = nil
+	if len(b) > 0 {
+		c.in = append([]byte(nil), b...)
+	}
+	return true
+}
+
+// handleFrame handles a client frame and returns whether to read the next
+// one. Once a close frame is queued only the close frame of the client is
+// handled, and the connection may go idle.
+func (c *epollConn) handleFrame(h ws.Header, payload []byte) bool {
+	if h.Masked {
+		ws.Cipher(payload, h.Mask, 0)
+	}
+	if h.OpCode == ws.OpClose {
+		if c.closeQueued.Load() {
+			// The answer to the close frame of the server.
+			c.closing.Store(true)
+			if c.closeSent.Load() {
+				c.close()
+			}
+			return false
+		}
+		// Echo the status code, then close.
+		var data []byte
+		code, reason := ws.ParseCloseFrameData(payload)
+		if !code.Empty() {
+			data = ws.NewCloseFrameBody(code, "")
+			c.e.s.setCloseStats(c.sess.id(), int(code), reason)
+		} else {
+			c.e.s.setCloseStats(c.sess.id(), websocket.CloseNoStatusReceived, "")
+		}
+		c.closing.Store(true)
+		c.sendClose(data)
+		return false
+	}
+	if c.closeQueued.Load() {
+		return true
+	}
+	if !h.Masked {
+		c.fail(ws.StatusProtocolError, "unmasked client frame")
+		return true
+	}
+	c.lastRead.Store(time.Now().UnixNano())
+
+	switch h.OpCode {
+	case ws.OpPing:
+		c.queue(prioControl, outFrame{messageType: websocket.PongMessage, data: payload})
+	case ws.OpPong:
+	case ws.OpText, ws.OpBinary:
+		if c.inMsg {
+			c.fail(ws.StatusProtocolError, "message interrupted by a new message")
+			return true
+		}
+		if !h.Fin {
+			c.message, c.inMsg = payload, true
+			return true
+		}
+		c.handleMessage(payload)
+	case ws.OpContinuation:
+		if !c.inMsg {
+			c.fail(ws.StatusProtocolError, "continuation without a message")
+			return true
+		}
+		c.message = append(c.message, payload...)
+		if h.Fin {
+			message := c.message
+			c.message, c.inMsg = nil, false
+			c.handleMessage(message)
+		}
+	default:
+		c.fail(ws.StatusProtocolError, fmt.Sprintf("unknown opcode %d", h.OpCode))
+	}
+	return true
+}
+
+// handleMessage executes a client message and queues the reply.
+func (c *epollConn) handleMessage(message []byte) {
+	s := c.e.s
+	s.addReceivedStats(c.sess.id(), int64(len(message)))
+
+	var reply interface{}
+	if c.rpc {
+		reply = s.handleRPC(c.sess, message)
+	} else if env := s.handleMessage(c.sess, message); env.Type != "" {
+		reply = env
+	}
+	if reply == nil {
+		return
+	}
+
+	if !c.queue(prioReply, outFrame{v: reply}) {
+		c.sess.log.Warn("reply queue full, closing")
+		s.setCloseStats(c.sess.id(), websocket.CloseAbnormalClosure, "reply queue full")
+		c.close()
+	}
+}
+
+func (c *epollConn) readError(err error) {
+	if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !errors.Is(err, syscall.ECONNRESET) {
+		c.sess.log.Warn("websocket read error", logging.Err(err))
+	}
+	c.close()
+}
+
+// fail sends a close frame after a protocol error.
+func (c *epollConn) fail(code ws.StatusCode, reason string) {
+	c.sendClose(ws.NewCloseFrameBody(code, reason))
+}
+
+// sendClose queues a close frame with data, unless one is queued already.
+// The connection is closed right away when the control lane is full.
+func (c *epollConn) sendClose(data []byte) {
+	if !c.closeQueued.CompareAndSwap(false, true) {
+		return
+	}
+	if code, reason := ws.ParseCloseFrameData(data); !code.Empty() {
+		c.e.s.setCloseStats(c.sess.id(), int(code), reason)
+	}
+	if !c.queue(prioControl, outFrame{messageType: websocket.CloseMessage, data: data}) {
+		c.close()
+	}
+}
+
+// queue pushes a frame to the outbound queue and makes sure a worker writes
+// it. It returns false when the lane of the frame is full.
+func (c *epollConn) queue(prio int, f outFrame) bool {
+	ok := c.out.push(prio, f)
+	if c.writing.CompareAndSwap(false, true) {
+		c.e.submit(epollTask{c: c, write: true})
+	}
+	return ok
+}
+
+// flush writes the queued frames, most urgent first. When the socket is full
+// the writing flag stays set and the flush goes on once it is writable.
+func (c *epollConn) flush() {
+	for {
+		if len(c.wbuf) > 0 {
+			done, err := c.write()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) && !errors.Is(err, syscall.EPIPE) && !errors.Is(err, syscall.ECONNRESET) {
+					c.sess.log.Warn("websocket write error", logging.Err(err))
+				}
+				// The writing flag stays set, nothing is scheduled anymore.
+				c.close()
+				return
+			}
+			if !done {
+				c.waitWritable()
+				return
+			}
+			if !c.written() {
+				return
+			}
+		}
+
+		f, ok := c.out.pop()
+		if !ok {
+			c.writing.Store(false)
+			// Frames pushed before the flag was cleared are written here.
+			if c.out.depth() == 0 || !c.writing.CompareAndSwap(false, true) {
+				return
+			}
+			continue
+		}
+		if c.closeSent.Load() {
+			continue
+		}
+		if err := c.encode(f); err != nil {
+			c.sess.log.Warn("websocket write error", logging.Err(err))
+			c.close()
+			return
+		}
+	}
+}
+
+// encode frames a queued frame into the write buffer, messages are encoded
+// with the session codec.
+func (c *epollConn) encode(f outFrame) error {
+	op, data := ws.OpCode(f.messageType), f.data
+	if f.v != nil {
+		var err error
+		if data, err = c.sess.codec.Marshal(f.v); err != nil {
+			return fmt.Errorf("%s marshal error: %w", c.sess.codec.Name(), err)
+		}
+		op = ws.OpText
+		if c.sess.codec.Binary() {
+			op = ws.OpBinary
+		}
+	}
+
+	h := ws.Header{Fin: true, OpCode: op, Length: int64(len(data))}
+	frame := bytes.NewBuffer(make([]byte, 0, ws.HeaderSize(h)+len(data)))
+	ws.WriteHeader(frame, h)
+	frame.Write(data)
+
+	c.wbuf, c.wframe, c.wsize, c.wstart = frame.Bytes(), f, int64(len(data)), time.Now()
+	return nil
+}
+
+// write writes the write buffer without waiting, it returns false when the
+// socket is full.
+func (c *epollConn) write() (bool, error) {
+	for len(c.wbuf) > 0 {
+		var n int
+		var werr error
+		err := c.raw.Write(func(fd uintptr) bool {
+			n, werr = syscall.Write(int(fd), c.wbuf)
+			return true
+		})
+		if err == nil {
+			err = werr
+		}
+
+		switch {
+		case errors.Is(err, syscall.EAGAIN):
+			c.blocked.CompareAndSwap(0, time.Now().UnixNano())
+			return false, nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case err != nil:
+			return false, err
+		}
+		c.wbuf = c.wbuf[n:]
+	}
+
+	c.wbuf = nil
+	c.blocked.Store(0)
+	return true, nil
+}
+
+// written accounts for the frame written, it returns false when the
+// connection closed after it.
+func (c *epollConn) written() bool {
+	s, f := c.e.s, c.wframe
+	c.wframe = outFrame{}
+
+	observeWrite(EngineEpoll, f, c.wstart)
+	if f.v != nil {
+		s.addBytesStats(c.sess.id(), c.wsize, int64(ws.HeaderSize(ws.Header{Length: c.wsize}))+c.wsize)
+	}
+	if f.value {
+		s.incStats(c.sess.id())
+	}
+
+	if f.messageType == websocket.CloseMessage {
+		c.closeSent.Store(true)
+		if c.closing.Load() {
+			c.close()
+			return false
+		}
+	}
+	return true
+}
+
+// close closes the connection and ends its session.
+func (c *epollConn) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.wantRead, c.wantWrite = false, false
+	if c.armed {
+		c.e.poller.remove(c.fd)
+	}
+	// Forgotten before closing, the descriptor can be reused right after.
+	c.e.forget(c)
+	c.limit.Stop()
+	c.conn.Close()
+	c.mu.Unlock()
+
+	s := c.e.s
+	_, maxDepth := c.out.stats()
+	s.observeQueueStats(c.sess.id(), maxDepth)
+	// Unless a close frame or another cause was recorded.
+	s.setCloseStats(c.sess.id(), websocket.CloseAbnormalClosure, "connection closed")
+	s.removeSession(c.sess)
+	s.endWebSocket()
+}
+
+func (c *epollConn) terminate(code int, reason string) {
+	c.sendClose(websocket.FormatCloseMessage(code, reason))
+	time.AfterFunc(closeGrace, c.close)
+}
+
+func (c *epollConn) notify(n notice) bool {
+	return c.queue(prioReply, n.frame(c.rpc))
+}
+
+// handlerWebSocketEpoll upgrades the connection and hands it to the epoll
+// engine, the handler returns right away.
+func (s *Server) handlerWebSocketEpoll(w http.ResponseWriter, r *http.Request) {
+	if !s.isValidOrigin(r.Header.Get("Origin")) {
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonOrigin).Inc()
+		s.error(w, http.StatusForbidden, fmt.Errorf("invalid origin"))
+		return
+	}
+
+	if !s.beginWebSocket() {
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonDraining).Inc()
+		s.error(w, http.StatusServiceUnavailable, fmt.Errorf("server is shutting down"))
+		return
+	}
+
+	subprotocols := append(codec.Names(), subprotocolJSONRPC)
+	upgrader := ws.HTTPUpgrader{
+		Timeout: 10 * time.Second,
+		Protocol: func(p string) bool {
+			return slices.Contains(subprotocols, p)
+		},
+	}
+
+	span := startUpgradeSpan(r.Context(), EngineEpoll)
+	conn, rw, hs, err := upgrader.Upgrade(r, w)
+	if err == nil {
+		var raw syscall.RawConn
+		var fd int
+		if raw, fd, err = connFd(conn); err == nil {
+			sess := newSession(transportWebSocket, r.RemoteAddr)
+			sess.setClient(r)
+			sess.protocol = hs.Protocol
+			// JSON-RPC sessions are JSON encoded.
+			rpc := hs.Protocol == subprotocolJSONRPC
+			if !rpc {
+				sess.codec = codec.Lookup(hs.Protocol)
+			}
+			endUpgradeSpan(span, hs.Protocol, nil)
+			s.epoll.add(conn, raw, fd, rw.Reader, sess, rpc)
+			return
+		}
+	}
+
+	endUpgradeSpan(span, "", err)
+	metrics.HandshakeFailures.WithLabelValues(metrics.ReasonUpgrade).Inc()
+	slog.WarnContext(r.Context(), "websocket upgrade failed", logging.Err(err))
+	if conn != nil {
+		conn.Close()
+	}
+	s.endWebSocket()
+}
+
+// connFd returns the raw connection and the file descriptor of a hijacked
+// connection.
+func connFd(conn net.Conn) (syscall.RawConn, int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, 0, fmt.Errorf("%T has no file descriptor", conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var fd int
+	if err := raw.Control(func(f uintptr) { fd = int(f) }); err != nil {
+		return nil, 0, err
+	}
+	return raw, fd, nil
+}
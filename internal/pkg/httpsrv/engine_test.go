@@ -0,0 +1,265 @@
+package httpsrv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+
+	"github.com/gobwas/ws"
+	"github.com/gorilla/websocket"
+)
+
+var benchSessions = flag.Int("sessions", 1000, "WebSocket sessions opened by BenchmarkSessionMemory")
+
+// benchRuns gives every benchmark run its own loopback source addresses, the
+// ports of the previous run are still in TIME_WAIT.
+var benchRuns byte
+
+func newEngineServer(tb testing.TB, engine string, workers int) (*Server, *httptest.Server) {
+	if engine == EngineEpoll && runtime.GOOS != "linux" {
+		tb.Skip("the epoll engine is only supported on Linux")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Engine = engine
+	cfg.EngineWorkers = workers
+	s := New(cfg, broker.NewLocal())
+	if err := s.startEngine(); err != nil {
+		tb.Fatal(err)
+	}
+	return s, httptest.NewServer(http.HandlerFunc(s.handlerWebSocket))
+}
+
+func (s *Server) sessionCount() int {
+	s.sessionsLock.RLock()
+	defer s.sessionsLock.RUnlock()
+	return len(s.sessions)
+}
+
+func TestEpollEngine(t *testing.T) {
+	s, srv := newEngineServer(t, EngineEpoll, 0)
+	defer srv.Close()
+	defer s.running.Wait()
+	defer s.cancel()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"http://localhost:8080"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for s.sessionCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.notifySessions(broker.Message{Seq: 1, Value: "a"})
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg != (wsMessage{Iteration: 1, Value: "a"}) {
+		t.Fatalf("got %+v, %v, want value a", msg, err)
+	}
+
+	if err := conn.WriteJSON(envelope{Type: cmdPing, ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	var reply envelope
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != replyAck || reply.ID != "1" {
+		t.Fatalf("got %+v, %v, want ack 1", reply, err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, make([]byte, wsReadLimit+1)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseMessageTooBig {
+		t.Fatalf("got %v, want close 1009", err)
+	}
+
+	for s.sessionCount() != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestEpollTimeLimit checks that epoll sessions end at the time limit, as the
+// sessions of the goroutine engine do.
+func TestEpollTimeLimit(t *testing.T) {
+	s, srv := newEngineServer(t, EngineEpoll, 0)
+	defer srv.Close()
+	defer s.running.Wait()
+	defer s.cancel()
+	s.epoll.timeLimit = 100 * time.Millisecond
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"http://localhost:8080"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("the session outlived its time limit")
+			}
+			break
+		}
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("the session ended after %v, want the time limit", d)
+	}
+	for s.sessionCount() != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestEpollSlowClients checks that a client sending half a frame and a client
+// not reading do not hold the only worker.
+func TestEpollSlowClients(t *testing.T) {
+	s, srv := newEngineServer(t, EngineEpoll, 1)
+	defer srv.Close()
+	defer s.running.Wait()
+	defer s.cancel()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	header := http.Header{"Origin": {"http://localhost:8080"}}
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// The client not reading gets frames until its socket is full.
+	dial()
+	for s.sessionCount() != 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	full := s.epoll.list()[0]
+	for i := 0; i < outReplySize; i++ {
+		full.queue(prioReply, outFrame{messageType: websocket.BinaryMessage, data: make([]byte, 1<<20)})
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for full.blocked.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a full socket")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The client sending half a frame.
+	half := dial()
+	raw := half.UnderlyingConn()
+	var frame bytes.Buffer
+	ws.WriteFrame(&frame, ws.MaskFrame(ws.NewTextFrame([]byte(`{"type":"ping","id":"half"}`))))
+	data := frame.Bytes()
+	if _, err := raw.Write(data[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := dial()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.WriteJSON(envelope{Type: cmdPing, ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	var reply envelope
+	if err := conn.ReadJSON(&reply); err != nil || reply.ID != "1" {
+		t.Fatalf("got %+v, %v, want ack 1 while the worker serves slow clients", reply, err)
+	}
+
+	// The rest of the frame completes it.
+	if _, err := raw.Write(data[3:]); err != nil {
+		t.Fatal(err)
+	}
+	half.SetReadDeadline(time.Now().Add(time.Second))
+	if err := half.ReadJSON(&reply); err != nil || reply.ID != "half" {
+		t.Fatalf("got %+v, %v, want ack half", reply, err)
+	}
+}
+
+// BenchmarkSessionMemory reports the memory and goroutines per idle WebSocket
+// session of each engine, the client connections included. 50k sessions need
+// a file descriptor limit above 100k:
+//
+//	ulimit -n 120000
+//	go test ./internal/pkg/httpsrv -run - -bench SessionMemory -benchtime 1x -sessions 50000
+func BenchmarkSessionMemory(b *testing.B) {
+	for _, engine := range []string{EngineGoroutine, EngineEpoll} {
+		b.Run(engine, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchSessionMemory(b, engine, *benchSessions)
+			}
+		})
+	}
+}
+
+func benchSessionMemory(b *testing.B, engine string, n int) {
+	s, srv := newEngineServer(b, engine, 0)
+	defer srv.Close()
+	defer s.running.Wait()
+	defer s.cancel()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	header := ws.HandshakeHeaderHTTP(http.Header{"Origin": {"http://localhost:8080"}})
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	goroutines := runtime.NumGoroutine()
+
+	benchRuns++
+	conns := make([]net.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		for s.sessionCount() != 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		// Every loopback source address has its own ephemeral ports.
+		local := &net.TCPAddr{IP: net.IPv4(127, benchRuns, byte(i/20000), 2)}
+		dialer := ws.Dialer{
+			Header: header,
+			NetDial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				d := net.Dialer{LocalAddr: local}
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+		conn, br, _, err := dialer.Dial(context.Background(), url)
+		if err != nil {
+			b.Fatalf("session %d: %v", i, err)
+		}
+		if br != nil {
+			ws.PutReader(br)
+		}
+		conns = append(conns, conn)
+	}
+	for s.sessionCount() != n {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	mem := int64(after.HeapInuse+after.StackInuse) - int64(before.HeapInuse+before.StackInuse)
+	b.ReportMetric(float64(mem)/float64(n), "B/session")
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines)/float64(n), "goroutines/session")
+}
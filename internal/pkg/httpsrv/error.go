@@ -1,11 +1,34 @@
 package httpsrv
 
 import (
-	"log"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+
+	"goapp/internal/pkg/logging"
 )
 
+// error writes an error response, err is logged with the request by the
+// access log.
 func (s *Server) error(w http.ResponseWriter, code int, err error) {
-	log.Printf("error: %+v\n", err)
+	if rec, ok := w.(*accessRecorder); ok {
+		rec.err = err
+	} else {
+		slog.Error("request error", slog.Int("status", code), logging.Err(err))
+	}
 	http.Error(w, http.StatusText(code), code)
 }
+
+// writeJSON writes v as a JSON response and returns the body size.
+func (s *Server) writeJSON(w http.ResponseWriter, code int, v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+		return 0
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	n, _ := w.Write(data)
+	return n
+}
@@ -0,0 +1,234 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"goapp/internal/pkg/watcher"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// errNoSubscriptionSession is returned when a subscription is not executed
+// over the graphql-transport-ws protocol.
+var errNoSubscriptionSession = errors.New("subscriptions require the graphql-transport-ws protocol")
+
+// sessionContextKey carries the session of a subscription in its context.
+type sessionContextKey struct{}
+
+// newGraphQLSchema builds the schema of the /goapp/graphql endpoint, resolved
+// from the hub, the history buffer and the session stats.
+func (s *Server) newGraphQLSchema() (graphql.Schema, error) {
+	sessionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Session",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"transport":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"remoteAddr": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"started":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"sent":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"rawBytes":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"wireBytes":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	statsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Stats",
+		Fields: graphql.Fields{
+			"sessions":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"sent":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"rawBytes":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"wireBytes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	messageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Message",
+		Fields: graphql.Fields{
+			"seq":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"value": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"time":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	counterType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Counter",
+		Fields: graphql.Fields{
+			"iteration": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"value":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"seq":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"sessions": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sessionType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var sessions []map[string]interface{}
+					for _, st := range s.AllSessionStats() {
+						sessions = append(sessions, sessionObject(st))
+					}
+					return sessions, nil
+				},
+			},
+			"session": &graphql.Field{
+				Type: sessionType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					st, exists := s.SessionStats(p.Args["id"].(string))
+					if !exists {
+						return nil, nil
+					}
+					return sessionObject(st), nil
+				},
+			},
+			"stats": &graphql.Field{
+				Type: graphql.NewNonNull(statsType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var sent, raw, wire int64
+					all := s.AllSessionStats()
+					for _, st := range all {
+						sent += st.Sent
+						raw += st.RawBytes
+						wire += st.WireBytes
+					}
+					return map[string]interface{}{
+						"sessions":  len(all),
+						"sent":      sent,
+						"rawBytes":  raw,
+						"wireBytes": wire,
+					}, nil
+				},
+			},
+			"history": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(messageType))),
+				Args: graphql.FieldConfigArgument{
+					"after": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					after, _ := p.Args["after"].(int)
+					if after < 0 {
+						return nil, fmt.Errorf("invalid after %d", after)
+					}
+
+					msgs := s.history.since(uint64(after))
+					if limit, ok := p.Args["limit"].(int); ok && limit >= 0 && limit < len(msgs) {
+						msgs = msgs[:limit]
+					}
+
+					history := make([]map[string]interface{}, 0, len(msgs))
+					for _, m := range msgs {
+						history = append(history, map[string]interface{}{
+							"seq":   m.Seq,
+							"value": m.Value,
+							"time":  m.Time.Format(time.RFC3339Nano),
+						})
+					}
+					return history, nil
+				},
+			},
+		},
+	})
+
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"values": &graphql.Field{
+				Type: graphql.NewNonNull(counterType),
+				Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+					sess, ok := p.Context.Value(sessionContextKey{}).(*session)
+					if !ok {
+						return nil, errNoSubscriptionSession
+					}
+					return forwardValues(p.Context, sess), nil
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					counter, ok := p.Source.(watcher.Counter)
+					if !ok {
+						return nil, errNoSubscriptionSession
+					}
+					return map[string]interface{}{
+						"iteration": counter.Iteration,
+						"value":     counter.Value,
+						"seq":       counter.Seq,
+					}, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Subscription: subscription,
+	})
+}
+
+func sessionObject(st SessionStats) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         st.ID,
+		"transport":  st.Transport,
+		"remoteAddr": st.RemoteAddr,
+		"started":    st.Started.Format(time.RFC3339Nano),
+		"sent":       st.Sent,
+		"rawBytes":   st.RawBytes,
+		"wireBytes":  st.WireBytes,
+	}
+}
+
+// forwardValues feeds the values of a subscription session to the GraphQL
+// executor until ctx is done.
+func forwardValues(ctx context.Context, sess *session) chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		for {
+			select {
+			case counter := <-sess.watch.Recv():
+				if !sess.wantsValue(counter.Value) {
+					continue
+				}
+				select {
+				case ch <- *counter:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// operationType validates a GraphQL request and returns the type of the
+// operation to execute: query, mutation or subscription.
+func operationType(schema graphql.Schema, query, operationName string) (string, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return "", gqlerrors.FormatErrors(err)
+	}
+
+	if result := graphql.ValidateDocument(&schema, doc, nil); !result.IsValid {
+		return "", result.Errors
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation, nil
+		}
+	}
+	return "", gqlerrors.FormatErrors(fmt.Errorf("unknown operation %q", operationName))
+}
@@ -0,0 +1,88 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestGraphQL(t *testing.T) {
+	s := New(DefaultConfig(), broker.NewLocal())
+	schema, err := s.newGraphQLSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.graphqlSchema = schema
+
+	srv := httptest.NewServer(http.HandlerFunc(s.handlerGraphQL))
+	defer srv.Close()
+
+	publish := func(seq uint64, value string) {
+		m := broker.Message{Seq: seq, Value: value, Time: time.Now()}
+		s.history.add(m)
+		s.notifySessions(m)
+	}
+	publish(1, "A1")
+	publish(2, "B2")
+
+	resp, err := http.Post(srv.URL, "application/json",
+		strings.NewReader(`{"query": "{ history(after: 1) { seq value } stats { sessions } }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Data   json.RawMessage
+		Errors []interface{}
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if want := `{"history":[{"seq":2,"value":"B2"}],"stats":{"sessions":0}}`; string(result.Data) != want {
+		t.Fatalf("got %s %v, want %s", result.Data, result.Errors, want)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocolGraphQL}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"),
+		http.Header{"Origin": {"http://localhost:8080"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	expect := func(want string) {
+		t.Helper()
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Fatalf("got %s, want %s", data, want)
+		}
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_init"}`))
+	expect(`{"type":"connection_ack"}`)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","type":"subscribe","payload":{"query":"subscription { values { iteration value } }"}}`))
+	for len(s.AllSessionStats()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	publish(3, "C3")
+	expect(`{"id":"1","type":"next","payload":{"data":{"values":{"iteration":1,"value":"C3"}}}}`)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"2","type":"subscribe","payload":{"query":"{ sessions { transport } }"}}`))
+	expect(`{"id":"2","type":"next","payload":{"data":{"sessions":[{"transport":"graphql"}]}}}`)
+	expect(`{"id":"2","type":"complete"}`)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","type":"complete"}`))
+	for len(s.AllSessionStats()) != 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,76 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type broadcastRequest struct {
+	noticePayload
+	Topic string `json:"topic,omitempty"`
+}
+
+type broadcastResult struct {
+	Delivered   int            `json:"delivered"`
+	Skipped     int            `json:"skipped"`     // Unsupported and QueueFull sessions.
+	Unsupported map[string]int `json:"unsupported"` // Sessions skipped by transport, those without notices.
+	QueueFull   int            `json:"queueFull"`   // Sessions skipped with a full queue.
+}
+
+// handlerBroadcast sends an announcement to every session of this node, or to
+// the sessions subscribed to the topic of the request. Only the WebSocket, SSE
+// and long-polling transports take notices, the sessions of the others are
+// skipped and counted by transport in the result.
+func (s *Server) handlerBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req broadcastRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, noticeMaxSize)).Decode(&req); err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("invalid announcement: %w", err))
+		return
+	}
+	if req.Text == "" && req.Data == nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("announcement needs a text or data"))
+		return
+	}
+	if len(req.Topic) > maxTopicLength {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("topic must be at most %d bytes", maxTopicLength))
+		return
+	}
+	req.Time = time.Now().UTC()
+
+	n := notice{typ: msgAnnouncement, payload: req.noticePayload}
+	res := broadcastResult{Unsupported: map[string]int{}}
+	for _, sess := range s.topicSessions(req.Topic) {
+		switch control := sess.controller(); {
+		case control == nil:
+			res.Unsupported[sess.transport]++
+		case control.notify(n):
+			res.Delivered++
+			continue
+		default:
+			res.QueueFull++
+		}
+		res.Skipped++
+	}
+
+	slog.InfoContext(r.Context(), "announcement sent", "remote_addr", r.RemoteAddr, "topic", req.Topic,
+		"delivered", res.Delivered, "unsupported", res.Unsupported, "queue_full", res.QueueFull)
+	s.writeJSON(w, http.StatusAccepted, res)
+}
+
+// topicSessions returns the sessions subscribed to topic, all the sessions
+// when topic is empty.
+func (s *Server) topicSessions(topic string) []*session {
+	s.sessionsLock.RLock()
+	defer s.sessionsLock.RUnlock()
+
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		if topic == "" || sess.subscribed(topic) {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
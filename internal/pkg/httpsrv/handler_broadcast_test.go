@@ -0,0 +1,59 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	c := newAdminClient(t, DefaultConfig())
+	s := c.s
+
+	var polls []*pollSession
+	for _, addr := range []string{"127.0.0.1:1", "127.0.0.1:2"} {
+		sess := newSession(transportPoll, addr)
+		ps := newPollSession(sess)
+		sess.control.Store(ps)
+		s.addSession(sess)
+		defer s.removeSession(sess)
+		polls = append(polls, ps)
+	}
+	polls[1].sess.subscribe("alerts")
+
+	grpc, err := s.OpenSession("grpc", "127.0.0.1:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpc.Close()
+
+	broadcast := func(body string) (int, broadcastResult) {
+		w := c.doBody(http.MethodPost, "/goapp/broadcast", body, true)
+		var res broadcastResult
+		json.NewDecoder(w.Body).Decode(&res)
+		return w.Code, res
+	}
+
+	if w := c.withPassword("").doBody(http.MethodPost, "/goapp/broadcast", `{"text":"hi"}`, true); w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want 401 without credentials", w.Code)
+	}
+	if code, _ := broadcast(`{"topic":"alerts"}`); code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400 for an empty announcement", code)
+	}
+	if code, res := broadcast(`{"text":"maintenance","topic":"alerts"}`); code != http.StatusAccepted || res.Delivered != 1 || res.Skipped != 0 {
+		t.Fatalf("got %d %+v, want 1 delivered", code, res)
+	}
+	if code, res := broadcast(`{"data":{"minutes":5}}`); code != http.StatusAccepted || res.Delivered != 2 || res.Skipped != 1 ||
+		len(res.Unsupported) != 1 || res.Unsupported["grpc"] != 1 || res.QueueFull != 0 {
+		t.Fatalf("got %d %+v, want 2 delivered and the grpc session skipped", code, res)
+	}
+
+	resp, _, _ := polls[0].since(0)
+	if len(resp.Notices) != 1 || resp.Notices[0].Type != msgAnnouncement {
+		t.Fatalf("got %+v, want one announcement", resp.Notices)
+	}
+	resp, _, _ = polls[1].since(0)
+	if len(resp.Notices) != 2 || resp.Notices[0].Payload.(noticePayload).Text != "maintenance" {
+		t.Fatalf("got %+v, want the topic and the global announcements", resp.Notices)
+	}
+}
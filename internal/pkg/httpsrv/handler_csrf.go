@@ -0,0 +1,21 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// handlerCSRF issues a CSRF token for clients that do not load the home page.
+// The token must be sent in the X-CSRF-Token header of every non-GET request,
+// along with the csrf_token cookie set here.
+func (s *Server) handlerCSRF(w http.ResponseWriter, r *http.Request) {
+	token := s.setCSRFToken(w)
+	if token == "" {
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("failed to issue CSRF token"))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, struct {
+		Token string `json:"token"`
+	}{token})
+}
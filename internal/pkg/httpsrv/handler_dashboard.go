@@ -0,0 +1,363 @@
+package httpsrv
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	dashboardInterval = time.Second // Updates of the dashboard feed.
+	dashboardCookie   = "dashboard_token"
+	dashboardTokenTTL = time.Hour // Lifetime of the feed token of a dashboard page.
+	dashboardSessions = 50        // Busiest sessions sent in an update.
+)
+
+// dashboardSession is a live session of a dashboard update, its rates are
+// per second since the previous update.
+type dashboardSession struct {
+	ID         string    `json:"id"`
+	Transport  string    `json:"transport"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Started    time.Time `json:"started"`
+	Sent       int64     `json:"sent"`
+	WireBytes  int64     `json:"wireBytes"`
+	Dropped    int64     `json:"dropped"`
+	SentRate   float64   `json:"sentRate"`
+	ByteRate   float64   `json:"byteRate"`
+}
+
+// dashboardUpdate is a message of the dashboard feed.
+type dashboardUpdate struct {
+	Time       time.Time          `json:"time"`
+	Sessions   []dashboardSession `json:"sessions"`   // The dashboardSessions busiest live sessions.
+	Total      int                `json:"total"`      // Live sessions.
+	Transports map[string]int     `json:"transports"` // Live sessions by transport.
+	Values     int64              `json:"values"`     // Values received by the hub.
+	ValueRate  float64            `json:"valueRate"`
+	Dropped    int64              `json:"dropped"` // Values dropped by all sessions.
+	DropRate   float64            `json:"dropRate"`
+}
+
+// dashboardFeed computes the updates of a feed connection.
+type dashboardFeed struct {
+	s    *Server
+	last dashboardUpdate
+	prev map[string]SessionStats // Session stats of the last update.
+}
+
+func (f *dashboardFeed) next() dashboardUpdate {
+	now := time.Now().UTC()
+	values, dropped := f.s.stats.totals()
+	u := dashboardUpdate{
+		Time:       now,
+		Sessions:   []dashboardSession{},
+		Transports: map[string]int{},
+		Values:     values,
+		Dropped:    dropped,
+	}
+
+	var elapsed float64
+	if !f.last.Time.IsZero() {
+		elapsed = now.Sub(f.last.Time).Seconds()
+		u.ValueRate = float64(values-f.last.Values) / elapsed
+		u.DropRate = float64(dropped-f.last.Dropped) / elapsed
+	}
+
+	all := f.s.AllSessionStats()
+	prev := make(map[string]SessionStats, len(all))
+	for _, st := range all {
+		ds := dashboardSession{
+			ID:         st.ID,
+			Transport:  st.Transport,
+			RemoteAddr: st.RemoteAddr,
+			Started:    st.Started,
+			Sent:       st.Sent,
+			WireBytes:  st.WireBytes,
+			Dropped:    st.Dropped,
+		}
+		if p, ok := f.prev[st.ID]; ok && elapsed > 0 {
+			ds.SentRate = float64(st.Sent-p.Sent) / elapsed
+			ds.ByteRate = float64(st.WireBytes-p.WireBytes) / elapsed
+		}
+		u.Sessions = append(u.Sessions, ds)
+		u.Transports[st.Transport]++
+		prev[st.ID] = st
+	}
+	u.Total = len(u.Sessions)
+
+	// The busiest first, then the oldest.
+	sort.Slice(u.Sessions, func(i, j int) bool {
+		a, b := u.Sessions[i], u.Sessions[j]
+		if a.ByteRate != b.ByteRate {
+			return a.ByteRate > b.ByteRate
+		}
+		if !a.Started.Equal(b.Started) {
+			return a.Started.Before(b.Started)
+		}
+		return a.ID < b.ID
+	})
+	if len(u.Sessions) > dashboardSessions {
+		u.Sessions = u.Sessions[:dashboardSessions]
+	}
+
+	f.last, f.prev = u, prev
+	return u
+}
+
+// handlerDashboard serves the admin dashboard page, along with the cookie
+// letting its feed connect when the browser does not send the credentials.
+// The cookie is secure when the page is requested over HTTPS, directly or
+// through a proxy, so the dashboard works over plain HTTP too.
+func (s *Server) handlerDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+
+	expires := time.Now().Add(dashboardTokenTTL).Unix()
+	token, err := s.secureCookie.Encode(dashboardCookie, expires)
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     dashboardCookie,
+		Value:    token,
+		Path:     "/goapp/admin",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(dashboardTokenTTL.Seconds()),
+	})
+
+	data := struct {
+		FeedURL template.JS
+	}{
+		FeedURL: template.JS(`(window.location.protocol === "https:" ? "wss://" : "ws://") + window.location.host + "/goapp/admin/feed"`),
+	}
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+	}
+}
+
+// handlerDashboardFeed sends a dashboardUpdate every dashboardInterval over a
+// WebSocket.
+func (s *Server) handlerDashboardFeed(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		HandshakeTimeout: 10 * time.Second,
+		CheckOrigin: func(r *http.Request) bool {
+			return s.isValidOrigin(r.Header.Get("Origin"))
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("websocket upgrade failed: %w", err))
+		return
+	}
+	defer conn.Close()
+
+	// The feed is one way, reading only serves the control frames.
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	conn.SetReadLimit(wsReadLimit)
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+
+	feed := &dashboardFeed{s: s}
+	for {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(feed.next()); err != nil {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if s.ctx.Err() != nil {
+				msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+			}
+			return
+		}
+	}
+}
+
+// validDashboardToken checks the unexpired cookie of a dashboard page.
+func (s *Server) validDashboardToken(r *http.Request) bool {
+	cookie, err := r.Cookie(dashboardCookie)
+	if err != nil {
+		return false
+	}
+	var expires int64
+	if err := s.secureCookie.Decode(dashboardCookie, cookie.Value, &expires); err != nil {
+		return false
+	}
+	return time.Now().Unix() < expires
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>GoApp Dashboard</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif;
+            max-width: 1200px;
+            margin: 0 auto;
+            padding: 1rem;
+            background-color: #f5f5f5;
+        }
+        .cards {
+            display: flex;
+            gap: 1rem;
+            margin: 1rem 0;
+        }
+        .card, .sessions {
+            background: white;
+            padding: 1rem 1.5rem;
+            border-radius: 8px;
+            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
+        }
+        .card {
+            flex: 1;
+        }
+        .card .value {
+            font-size: 1.8rem;
+            font-weight: bold;
+        }
+        .card .detail, .sessions .detail {
+            color: #666;
+        }
+        table {
+            width: 100%;
+            border-collapse: collapse;
+            font-size: 0.9rem;
+        }
+        th, td {
+            text-align: left;
+            padding: 0.4rem;
+            border-bottom: 1px solid #eee;
+        }
+        td.num, th.num {
+            text-align: right;
+            font-family: monospace;
+        }
+        #status.connected {
+            color: #4CAF50;
+        }
+        #status.disconnected {
+            color: #f44336;
+        }
+    </style>
+</head>
+<body>
+    <h1>GoApp Dashboard <small id="status" class="disconnected">disconnected</small></h1>
+    <div class="cards">
+        <div class="card">
+            <div>Sessions</div>
+            <div class="value" id="sessions">0</div>
+            <div class="detail" id="transports"></div>
+        </div>
+        <div class="card">
+            <div>Generator</div>
+            <div class="value" id="valueRate">0/s</div>
+            <div class="detail" id="values">0 values</div>
+        </div>
+        <div class="card">
+            <div>Drops</div>
+            <div class="value" id="dropRate">0/s</div>
+            <div class="detail" id="dropped">0 values</div>
+        </div>
+    </div>
+    <div class="sessions">
+        <div class="detail" id="shown"></div>
+        <table>
+            <thead>
+                <tr>
+                    <th>ID</th>
+                    <th>Transport</th>
+                    <th>Client</th>
+                    <th>Started</th>
+                    <th class="num">Sent</th>
+                    <th class="num">Values/s</th>
+                    <th class="num">Bytes/s</th>
+                    <th class="num">Dropped</th>
+                </tr>
+            </thead>
+            <tbody id="rows"></tbody>
+        </table>
+    </div>
+    <script>
+    (function() {
+        const $ = (id) => document.getElementById(id);
+        const rate = (v) => v.toFixed(1) + "/s";
+
+        function cell(row, text, num) {
+            const td = document.createElement("td");
+            td.textContent = text;
+            if (num) {
+                td.className = "num";
+            }
+            row.appendChild(td);
+        }
+
+        function render(u) {
+            $("sessions").textContent = u.total;
+            $("transports").textContent = Object.keys(u.transports).sort()
+                .map((t) => t + " " + u.transports[t]).join(", ");
+            $("valueRate").textContent = rate(u.valueRate);
+            $("values").textContent = u.values + " values";
+            $("dropRate").textContent = rate(u.dropRate);
+            $("dropped").textContent = u.dropped + " values";
+            $("shown").textContent = u.sessions.length < u.total
+                ? "Busiest " + u.sessions.length + " of " + u.total + " sessions" : "";
+
+            const rows = document.createDocumentFragment();
+            for (const s of u.sessions) {
+                const row = document.createElement("tr");
+                cell(row, s.id.slice(0, 8));
+                cell(row, s.transport);
+                cell(row, s.remoteAddr);
+                cell(row, new Date(s.started).toLocaleTimeString());
+                cell(row, s.sent, true);
+                cell(row, s.sentRate.toFixed(1), true);
+                cell(row, s.byteRate.toFixed(0), true);
+                cell(row, s.dropped, true);
+                rows.appendChild(row);
+            }
+            $("rows").replaceChildren(rows);
+        }
+
+        function connect() {
+            const ws = new WebSocket({{.FeedURL}});
+            ws.onopen = () => {
+                $("status").textContent = "live";
+                $("status").className = "connected";
+            };
+            ws.onmessage = (evt) => render(JSON.parse(evt.data));
+            ws.onclose = () => {
+                $("status").textContent = "disconnected";
+                $("status").className = "disconnected";
+                setTimeout(connect, 2000);
+            };
+        }
+        connect();
+    })();
+    </script>
+</body>
+</html>
+`))
@@ -0,0 +1,108 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDashboardFeed(t *testing.T) {
+	c := newAdminClient(t, DefaultConfig())
+
+	sess, err := c.s.OpenSession("tcp", "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	sess.Sent(10)
+
+	srv := httptest.NewServer(c.handler)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/goapp/admin/feed"
+
+	header := http.Header{"Origin": {"http://localhost:8080"}}
+	if _, resp, err := websocket.DefaultDialer.Dial(url, header); err == nil || resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("got %v, want 401 with a basic authentication challenge without credentials", err)
+	}
+
+	// page gets the dashboard page and returns its cookie.
+	page := func(proto string) *http.Cookie {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/goapp/admin", nil)
+		req.SetBasicAuth("admin", testPassword)
+		if proto != "" {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'unsafe-inline'") {
+			t.Fatalf("got CSP %q, want the inline script of the page allowed", csp)
+		}
+		cookies := resp.Cookies()
+		if len(cookies) != 1 || cookies[0].Name != dashboardCookie {
+			t.Fatalf("got cookies %v, want the dashboard token", cookies)
+		}
+		return cookies[0]
+	}
+	if cookie := page("https"); !cookie.Secure {
+		t.Fatal("got a cookie not secure behind an HTTPS proxy")
+	}
+
+	// The cookie of the dashboard page lets the feed connect.
+	cookie := page("")
+	if cookie.Secure {
+		t.Fatal("got a secure cookie over HTTP")
+	}
+	header.Set("Cookie", cookie.String())
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var u dashboardUpdate
+	if err := conn.ReadJSON(&u); err != nil {
+		t.Fatal(err)
+	}
+	if len(u.Sessions) != 1 || u.Total != 1 || u.Sessions[0].ID != sess.ID() || u.Sessions[0].Sent != 1 || u.Transports["tcp"] != 1 {
+		t.Fatalf("got %+v, want the tcp session", u)
+	}
+}
+
+func TestDashboardBusiestSessions(t *testing.T) {
+	s := New(DefaultConfig(), broker.NewLocal())
+
+	var sessions []*Session
+	for i := 0; i < dashboardSessions+5; i++ {
+		sess, err := s.OpenSession("tcp", "127.0.0.1:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sess.Close()
+		sessions = append(sessions, sess)
+	}
+
+	feed := &dashboardFeed{s: s}
+	if u := feed.next(); u.Total != len(sessions) || len(u.Sessions) != dashboardSessions {
+		t.Fatalf("got %d of %d sessions, want %d of %d", len(u.Sessions), u.Total, dashboardSessions, len(sessions))
+	}
+
+	// The session sending since the last update comes first.
+	busiest := sessions[len(sessions)-1]
+	busiest.Sent(100)
+	time.Sleep(10 * time.Millisecond)
+	u := feed.next()
+	if u.Sessions[0].ID != busiest.ID() || u.Sessions[0].ByteRate <= 0 {
+		t.Fatalf("got %+v first, want the busiest session", u.Sessions[0])
+	}
+}
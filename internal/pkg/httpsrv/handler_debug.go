@@ -0,0 +1,243 @@
+package httpsrv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"goapp/internal/pkg/watcher"
+
+	"github.com/gorilla/mux"
+)
+
+// debugStackDepth is the number of frames kept of a goroutine stack in the
+// goroutine dump.
+const debugStackDepth = 8
+
+// goroutineGroup is a set of goroutines of a session, or of none.
+type goroutineGroup struct {
+	Session    string           `json:"session,omitempty"`
+	Transport  string           `json:"transport,omitempty"`
+	Live       bool             `json:"live"` // The session is in the hub, false for goroutines it left behind.
+	Goroutines int              `json:"goroutines"`
+	Stacks     []goroutineStack `json:"stacks"`
+}
+
+// goroutineStack is a stack shared by count goroutines, innermost frame
+// first.
+type goroutineStack struct {
+	Count  int      `json:"count"`
+	Frames []string `json:"frames"`
+}
+
+type goroutineDump struct {
+	Total     int              `json:"total"`
+	Sessions  []goroutineGroup `json:"sessions"`
+	Unlabeled goroutineGroup   `json:"unlabeled"` // Goroutines of no session.
+}
+
+type heapSummary struct {
+	HeapAllocBytes    uint64    `json:"heapAllocBytes"`
+	HeapInuseBytes    uint64    `json:"heapInuseBytes"`
+	HeapIdleBytes     uint64    `json:"heapIdleBytes"`
+	HeapReleasedBytes uint64    `json:"heapReleasedBytes"`
+	HeapObjects       uint64    `json:"heapObjects"`
+	StackInuseBytes   uint64    `json:"stackInuseBytes"`
+	SysBytes          uint64    `json:"sysBytes"`
+	NextGCBytes       uint64    `json:"nextGCBytes"`
+	NumGC             uint32    `json:"numGC"`
+	LastGC            time.Time `json:"lastGC"`
+	PauseTotalMs      float64   `json:"pauseTotalMs"`
+	Goroutines        int       `json:"goroutines"`
+}
+
+// debugCounts compares the running watchers with the sessions expecting one.
+type debugCounts struct {
+	Sessions    int            `json:"sessions"`    // Sessions in the hub.
+	Transports  map[string]int `json:"transports"`  // Sessions in the hub by transport.
+	Stats       int            `json:"stats"`       // Sessions with stats.
+	Polls       int            `json:"polls"`       // Long-polling sessions.
+	WebSockets  int            `json:"webSockets"`  // Live WebSocket connections.
+	Watchers    int64          `json:"watchers"`    // Running watcher goroutines.
+	WatchersDue int            `json:"watchersDue"` // Sessions of the hub running a watcher goroutine.
+	Goroutines  int            `json:"goroutines"`
+}
+
+// handlerDebugPprof serves the pprof index and profiles.
+func (s *Server) handlerDebugPprof(w http.ResponseWriter, r *http.Request) {
+	switch name := mux.Vars(r)["profile"]; name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+// handlerDebugGoroutines returns the goroutines grouped by the session they
+// serve, from their profiler labels.
+func (s *Server) handlerDebugGoroutines(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := rpprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dump := goroutineDump{Sessions: []goroutineGroup{}, Unlabeled: goroutineGroup{Stacks: []goroutineStack{}}}
+	groups := map[string]*goroutineGroup{}
+	for _, rec := range parseGoroutineProfile(&buf) {
+		dump.Total += rec.Count
+		group := &dump.Unlabeled
+		if id := rec.labels[labelSession]; id != "" {
+			if group = groups[id]; group == nil {
+				group = &goroutineGroup{
+					Session:   id,
+					Transport: rec.labels[labelTransport],
+					Live:      s.getSession(id) != nil,
+				}
+				groups[id] = group
+			}
+		}
+		group.Goroutines += rec.Count
+		group.Stacks = append(group.Stacks, rec.goroutineStack)
+	}
+
+	for _, group := range groups {
+		dump.Sessions = append(dump.Sessions, *group)
+	}
+	// Sessions no longer in the hub first, they are the leaks.
+	sort.Slice(dump.Sessions, func(i, j int) bool {
+		a, b := dump.Sessions[i], dump.Sessions[j]
+		if a.Live != b.Live {
+			return !a.Live
+		}
+		return a.Session < b.Session
+	})
+
+	s.writeJSON(w, http.StatusOK, dump)
+}
+
+// handlerDebugHeap returns a summary of the heap, after a garbage collection
+// when the gc query parameter is true.
+func (s *Server) handlerDebugHeap(w http.ResponseWriter, r *http.Request) {
+	if gc, _ := strconv.ParseBool(r.URL.Query().Get("gc")); gc {
+		runtime.GC()
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	h := heapSummary{
+		HeapAllocBytes:    m.HeapAlloc,
+		HeapInuseBytes:    m.HeapInuse,
+		HeapIdleBytes:     m.HeapIdle,
+		HeapReleasedBytes: m.HeapReleased,
+		HeapObjects:       m.HeapObjects,
+		StackInuseBytes:   m.StackInuse,
+		SysBytes:          m.Sys,
+		NextGCBytes:       m.NextGC,
+		NumGC:             m.NumGC,
+		PauseTotalMs:      milliseconds(time.Duration(m.PauseTotalNs)),
+		Goroutines:        runtime.NumGoroutine(),
+	}
+	if m.LastGC > 0 {
+		h.LastGC = time.Unix(0, int64(m.LastGC)).UTC()
+	}
+
+	s.writeJSON(w, http.StatusOK, h)
+}
+
+// handlerDebugCounts returns the number of running watchers against the
+// number of sessions, more watchers than due means leaked ones.
+func (s *Server) handlerDebugCounts(w http.ResponseWriter, r *http.Request) {
+	c := debugCounts{Transports: map[string]int{}}
+
+	s.sessionsLock.RLock()
+	for _, sess := range s.sessions {
+		c.Sessions++
+		c.Transports[sess.transport]++
+		// Epoll sessions deliver without a watcher goroutine.
+		if sess.deliver == nil {
+			c.WatchersDue++
+		}
+	}
+	s.sessionsLock.RUnlock()
+
+	s.stats.mu.RLock()
+	c.Stats = len(s.stats.sessions)
+	s.stats.mu.RUnlock()
+
+	s.pollsLock.RLock()
+	c.Polls = len(s.polls)
+	s.pollsLock.RUnlock()
+
+	s.drainLock.Lock()
+	c.WebSockets = s.webSocketCount
+	s.drainLock.Unlock()
+
+	c.Watchers = watcher.Running()
+	c.Goroutines = runtime.NumGoroutine()
+
+	s.writeJSON(w, http.StatusOK, c)
+}
+
+// goroutineRecord is a record of a goroutine profile in the debug=1 text
+// format.
+type goroutineRecord struct {
+	goroutineStack
+	labels map[string]string
+}
+
+// parseGoroutineProfile parses a goroutine profile written with debug=1:
+// records of a "<count> @ <pcs>" line, an optional "# labels: {...}" line
+// and "#\t<pc>\t<func>+<off>\t<file>:<line>" frames, separated by blank
+// lines.
+func parseGoroutineProfile(buf *bytes.Buffer) []goroutineRecord {
+	var records []goroutineRecord
+	var rec *goroutineRecord
+
+	sc := bufio.NewScanner(buf)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			rec = nil
+		case rec == nil:
+			count, _, ok := strings.Cut(line, " @ ")
+			if !ok {
+				continue // The header line.
+			}
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				continue
+			}
+			records = append(records, goroutineRecord{goroutineStack: goroutineStack{Count: n, Frames: []string{}}})
+			rec = &records[len(records)-1]
+		case strings.HasPrefix(line, "# labels: "):
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &rec.labels)
+		case strings.HasPrefix(line, "#\t") && len(rec.Frames) < debugStackDepth:
+			// Tabs align the columns, the file is the last one.
+			fields := strings.Fields(line[1:])
+			if len(fields) == 3 {
+				fn, _, _ := strings.Cut(fields[1], "+")
+				rec.Frames = append(rec.Frames, fn+" "+fields[2])
+			}
+		}
+	}
+	return records
+}
@@ -0,0 +1,43 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestDebugGoroutines(t *testing.T) {
+	c := newAdminClient(t, DefaultConfig())
+
+	sess, err := c.s.OpenSession("tcp", "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+
+	if w := c.withPassword("wrong").do(http.MethodGet, "/goapp/debug/goroutines", false); w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want 401 with a wrong password", w.Code)
+	}
+
+	var dump goroutineDump
+	if err := json.NewDecoder(c.do(http.MethodGet, "/goapp/debug/goroutines", false).Body).Decode(&dump); err != nil {
+		t.Fatal(err)
+	}
+	var group *goroutineGroup
+	for i := range dump.Sessions {
+		if dump.Sessions[i].Session == sess.ID() {
+			group = &dump.Sessions[i]
+		}
+	}
+	if group == nil || !group.Live || group.Transport != "tcp" || group.Goroutines != 1 {
+		t.Fatalf("got %+v, want the watcher goroutine of the live session", dump.Sessions)
+	}
+
+	var counts debugCounts
+	if err := json.NewDecoder(c.do(http.MethodGet, "/goapp/debug/counts", false).Body).Decode(&counts); err != nil {
+		t.Fatal(err)
+	}
+	if counts.Sessions != 1 || counts.WatchersDue != 1 || counts.Watchers < 1 || counts.Stats != 1 {
+		t.Fatalf("got %+v, want one session and its watcher", counts)
+	}
+}
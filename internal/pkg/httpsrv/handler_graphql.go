@@ -0,0 +1,384 @@
+package httpsrv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"goapp/internal/pkg/logging"
+	"goapp/internal/pkg/metrics"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// subprotocolGraphQL is the graphql-transport-ws protocol of GraphQL over
+// WebSocket, see https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md.
+const subprotocolGraphQL = "graphql-transport-ws"
+
+const gqlInitTimeout = 10 * time.Second // Wait for connection_init.
+
+// graphql-transport-ws message types.
+const (
+	gqlConnectionInit = "connection_init"
+	gqlConnectionAck  = "connection_ack"
+	gqlPing           = "ping"
+	gqlPong           = "pong"
+	gqlSubscribe      = "subscribe"
+	gqlNext           = "next"
+	gqlError          = "error"
+	gqlComplete       = "complete"
+)
+
+// graphql-transport-ws close codes.
+const (
+	gqlCloseBadRequest      = 4400
+	gqlCloseUnauthorized    = 4401
+	gqlCloseBadSubprotocol  = 4406
+	gqlCloseInitTimeout     = 4408
+	gqlCloseSubscriberExist = 4409
+	gqlCloseTooManyInits    = 4429
+)
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type gqlMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// gqlOutgoing is a message written by the connection writer, sess is set for
+// values counted in the session stats.
+type gqlOutgoing struct {
+	msg  gqlMessage
+	sess *session
+}
+
+// handlerGraphQL executes queries sent with POST, or with GET as query
+// parameters. WebSocket upgrades are served by handlerGraphQLWebSocket.
+func (s *Server) handlerGraphQL(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.handlerGraphQLWebSocket(w, r)
+		return
+	}
+
+	var req graphqlRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("invalid GraphQL request: %w", err))
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				s.error(w, http.StatusBadRequest, fmt.Errorf("invalid GraphQL variables: %w", err))
+				return
+			}
+		}
+	}
+
+	op, errs := operationType(s.graphqlSchema, req.Query, req.OperationName)
+	if errs != nil {
+		s.writeJSON(w, http.StatusOK, &graphql.Result{Errors: errs})
+		return
+	}
+	if op == "subscription" {
+		s.writeJSON(w, http.StatusOK, &graphql.Result{
+			Errors: gqlerrors.FormatErrors(errNoSubscriptionSession),
+		})
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, graphql.Do(graphql.Params{
+		Schema:         s.graphqlSchema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        r.Context(),
+	}))
+}
+
+// handlerGraphQLWebSocket serves queries and subscriptions over the
+// graphql-transport-ws protocol. Every subscription is a session of its own.
+func (s *Server) handlerGraphQLWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.beginWebSocket() {
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonDraining).Inc()
+		s.error(w, http.StatusServiceUnavailable, fmt.Errorf("server is shutting down"))
+		return
+	}
+	defer s.endWebSocket()
+
+	upgrader := websocket.Upgrader{
+		HandshakeTimeout: 10 * time.Second,
+		ReadBufferSize:   s.cfg.ReadBufferSize,
+		WriteBufferSize:  s.cfg.WriteBufferSize,
+		Subprotocols:     []string{subprotocolGraphQL},
+		CheckOrigin: func(r *http.Request) bool {
+			return s.isValidOrigin(r.Header.Get("Origin"))
+		},
+	}
+
+	cw := &countingResponseWriter{ResponseWriter: w}
+	conn, err := upgrader.Upgrade(cw, r, nil)
+	if err != nil {
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonUpgrade).Inc()
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("websocket upgrade failed: %w", err))
+		return
+	}
+	defer conn.Close()
+
+	closeWith := func(code int, reason string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+
+	if conn.Subprotocol() != subprotocolGraphQL {
+		closeWith(gqlCloseBadSubprotocol, "Subprotocol not acceptable")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
+
+	conn.SetReadLimit(1 << 16)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+
+	var (
+		outCh     = make(chan gqlOutgoing, 16)
+		acked     = make(chan struct{})
+		subs      = make(map[string]context.CancelFunc) // Running operations by ID.
+		subsLock  sync.Mutex
+		operation sync.WaitGroup
+		readDone  = make(chan struct{})
+	)
+	// Stop the reader before waiting for the operations it started.
+	defer func() {
+		cancel()
+		conn.Close()
+		<-readDone
+		operation.Wait()
+	}()
+
+	send := func(msg gqlMessage, sess *session) bool {
+		select {
+		case outCh <- gqlOutgoing{msg: msg, sess: sess}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(readDone)
+		defer cancel()
+
+		initialised := false
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+					slog.WarnContext(r.Context(), "graphql websocket read error", logging.Err(err))
+				}
+				return
+			}
+
+			var msg gqlMessage
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+				closeWith(gqlCloseBadRequest, "Invalid message received")
+				return
+			}
+
+			switch msg.Type {
+			case gqlConnectionInit:
+				if initialised {
+					closeWith(gqlCloseTooManyInits, "Too many initialisation requests")
+					return
+				}
+				initialised = true
+				close(acked)
+				send(gqlMessage{Type: gqlConnectionAck}, nil)
+
+			case gqlPing:
+				send(gqlMessage{Type: gqlPong}, nil)
+
+			case gqlPong:
+
+			case gqlSubscribe:
+				if !initialised {
+					closeWith(gqlCloseUnauthorized, "Unauthorized")
+					return
+				}
+				var req graphqlRequest
+				if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+					closeWith(gqlCloseBadRequest, "Invalid subscribe message")
+					return
+				}
+
+				subsLock.Lock()
+				if _, exists := subs[msg.ID]; exists {
+					subsLock.Unlock()
+					closeWith(gqlCloseSubscriberExist, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+					return
+				}
+				opCtx, opCancel := context.WithCancel(ctx)
+				subs[msg.ID] = opCancel
+				subsLock.Unlock()
+
+				operation.Add(1)
+				go func(id string) {
+					defer operation.Done()
+					defer func() {
+						subsLock.Lock()
+						delete(subs, id)
+						subsLock.Unlock()
+						opCancel()
+					}()
+					s.runGraphQLOperation(opCtx, r, id, req, send)
+				}(msg.ID)
+
+			case gqlComplete:
+				subsLock.Lock()
+				if opCancel, exists := subs[msg.ID]; exists {
+					opCancel()
+				}
+				subsLock.Unlock()
+
+			default:
+				closeWith(gqlCloseBadRequest, fmt.Sprintf("Invalid message type %q", msg.Type))
+				return
+			}
+		}
+	}()
+
+	initTimer := time.NewTimer(gqlInitTimeout)
+	defer initTimer.Stop()
+
+	pingTicker := time.NewTicker(wsPingPeriod)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.drainChannel:
+			if err := closeGoingAway(conn); err == nil {
+				<-ctx.Done()
+			}
+			return
+		case <-initTimer.C:
+			select {
+			case <-acked:
+			default:
+				closeWith(gqlCloseInitTimeout, "Connection initialisation timeout")
+				return
+			}
+		case <-pingTicker.C:
+			if err := conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case out := <-outCh:
+			data, err := json.Marshal(out.msg)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "graphql marshal error", logging.Err(err))
+				continue
+			}
+
+			written := cw.conn.written.Load()
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				slog.WarnContext(r.Context(), "graphql websocket write error", logging.Err(err))
+				return
+			}
+			if out.sess != nil {
+				s.incStats(out.sess.id())
+				s.addBytesStats(out.sess.id(), int64(len(data)), cw.conn.written.Load()-written)
+			}
+		}
+	}
+}
+
+// runGraphQLOperation executes a subscribe request and sends its results
+// until it completes or ctx is done. Subscriptions run in a new session.
+func (s *Server) runGraphQLOperation(ctx context.Context, r *http.Request, id string, req graphqlRequest,
+	send func(gqlMessage, *session) bool) {
+
+	op, errs := operationType(s.graphqlSchema, req.Query, req.OperationName)
+	if errs != nil {
+		payload, _ := json.Marshal(errs)
+		send(gqlMessage{ID: id, Type: gqlError, Payload: payload}, nil)
+		return
+	}
+
+	var sess *session
+	if op == "subscription" {
+		var err error
+		if sess, err = startSession(transportGraphQL, r.RemoteAddr); err != nil {
+			payload, _ := json.Marshal(gqlerrors.FormatErrors(err))
+			send(gqlMessage{ID: id, Type: gqlError, Payload: payload}, nil)
+			return
+		}
+		sess.setClient(r)
+		s.addSession(sess)
+		defer s.removeSession(sess)
+		// Unless another cause was recorded.
+		defer s.setCloseStats(sess.id(), 0, "operation ended")
+		ctx = context.WithValue(ctx, sessionContextKey{}, sess)
+	}
+
+	params := graphql.Params{
+		Schema:         s.graphqlSchema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        ctx,
+	}
+
+	var results chan *graphql.Result
+	if op == "subscription" {
+		results = graphql.Subscribe(params)
+	} else {
+		results = oneResult(graphql.Do(params))
+	}
+
+	// Drain the results, the executor blocks until they are read.
+	for result := range results {
+		if ctx.Err() != nil {
+			continue
+		}
+		payload, err := json.Marshal(result)
+		if err != nil {
+			slog.ErrorContext(ctx, "graphql marshal error", logging.Err(err))
+			continue
+		}
+		send(gqlMessage{ID: id, Type: gqlNext, Payload: payload}, sess)
+	}
+
+	// Operations completed by the client are not acknowledged.
+	if ctx.Err() == nil {
+		send(gqlMessage{ID: id, Type: gqlComplete}, nil)
+	}
+}
+
+func oneResult(result *graphql.Result) chan *graphql.Result {
+	ch := make(chan *graphql.Result, 1)
+	ch <- result
+	close(ch)
+	return ch
+}
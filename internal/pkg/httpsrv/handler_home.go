@@ -77,6 +77,12 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
             background-color: #2196F3;
             color: white;
         }
+        #encoding {
+            width: 100%;
+            padding: 0.5rem;
+            margin-bottom: 1rem;
+            font-size: 1rem;
+        }
         #output {
             height: 70vh;
             overflow-y: auto;
@@ -100,6 +106,9 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
         .message.error {
             background-color: #ffebee;
         }
+        .message.notice {
+            background-color: #fff8e1;
+        }
         .hex-value {
             font-family: monospace;
             color: #2196F3;
@@ -135,6 +144,12 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
             <div id="connection-status" class="disconnected">
                 Disconnected
             </div>
+            <label for="encoding">Encoding</label>
+            <select id="encoding">
+                <option value="json">JSON</option>
+                <option value="msgpack">MessagePack</option>
+                <option value="cbor">CBOR</option>
+            </select>
             <div class="button-group">
                 <button id="open">Connect</button>
                 <button id="close" disabled>Disconnect</button>
@@ -160,12 +175,16 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
         const closeBtn = document.getElementById("close");
         const sendBtn = document.getElementById("send");
         const statusDiv = document.getElementById("connection-status");
+        const encodingSelect = document.getElementById("encoding");
         let ws;
+        let codec;
+        let commandID = 0;
 
         function updateConnectionStatus(connected) {
             statusDiv.textContent = connected ? "Connected" : "Disconnected";
             statusDiv.className = connected ? "connected" : "disconnected";
             openBtn.disabled = connected;
+            encodingSelect.disabled = connected;
             closeBtn.disabled = !connected;
             sendBtn.disabled = !connected;
         }
@@ -178,13 +197,295 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
             output.scrollTop = output.scrollHeight;
         }
 
+        function escapeHTML(str) {
+            const div = document.createElement("div");
+            div.textContent = str;
+            return div.innerHTML;
+        }
+
+        // Minimal MessagePack and CBOR codecs for the protocol messages.
+        function msgpackDecode(buf) {
+            const view = new DataView(buf);
+            const bytes = new Uint8Array(buf);
+            const text = new TextDecoder();
+            let pos = 0;
+
+            function str(n) { const s = text.decode(bytes.subarray(pos, pos + n)); pos += n; return s; }
+            function bin(n) { const b = bytes.slice(pos, pos + n); pos += n; return b; }
+            function arr(n) { const a = []; for (let i = 0; i < n; i++) { a.push(read()); } return a; }
+            function map(n) { const m = {}; for (let i = 0; i < n; i++) { const k = read(); m[k] = read(); } return m; }
+            function u8() { return bytes[pos++]; }
+            function u16() { const v = view.getUint16(pos); pos += 2; return v; }
+            function u32() { const v = view.getUint32(pos); pos += 4; return v; }
+            function ext(n) {
+                const type = view.getInt8(pos);
+                const start = pos + 1;
+                pos = start + n;
+                if (type !== -1) {
+                    return null;
+                }
+                // Timestamp extension.
+                if (n === 4) {
+                    return new Date(view.getUint32(start) * 1000);
+                }
+                if (n === 8) {
+                    const hi = view.getUint32(start);
+                    const sec = (hi & 0x3) * 4294967296 + view.getUint32(start + 4);
+                    return new Date(sec * 1000 + (hi >>> 2) / 1e6);
+                }
+                return new Date(Number(view.getBigInt64(start + 4)) * 1000 + view.getUint32(start) / 1e6);
+            }
+            function read() {
+                const b = bytes[pos++];
+                let v;
+                if (b <= 0x7f) { return b; }
+                if (b >= 0xe0) { return b - 0x100; }
+                if ((b & 0xe0) === 0xa0) { return str(b & 0x1f); }
+                if ((b & 0xf0) === 0x90) { return arr(b & 0x0f); }
+                if ((b & 0xf0) === 0x80) { return map(b & 0x0f); }
+                switch (b) {
+                case 0xc0: return null;
+                case 0xc2: return false;
+                case 0xc3: return true;
+                case 0xc4: return bin(u8());
+                case 0xc5: return bin(u16());
+                case 0xc6: return bin(u32());
+                case 0xc7: return ext(u8());
+                case 0xc8: return ext(u16());
+                case 0xc9: return ext(u32());
+                case 0xca: v = view.getFloat32(pos); pos += 4; return v;
+                case 0xcb: v = view.getFloat64(pos); pos += 8; return v;
+                case 0xcc: return u8();
+                case 0xcd: return u16();
+                case 0xce: return u32();
+                case 0xcf: v = Number(view.getBigUint64(pos)); pos += 8; return v;
+                case 0xd0: return view.getInt8(pos++);
+                case 0xd1: v = view.getInt16(pos); pos += 2; return v;
+                case 0xd2: v = view.getInt32(pos); pos += 4; return v;
+                case 0xd3: v = Number(view.getBigInt64(pos)); pos += 8; return v;
+                case 0xd4: return ext(1);
+                case 0xd5: return ext(2);
+                case 0xd6: return ext(4);
+                case 0xd7: return ext(8);
+                case 0xd8: return ext(16);
+                case 0xd9: return str(u8());
+                case 0xda: return str(u16());
+                case 0xdb: return str(u32());
+                case 0xdc: return arr(u16());
+                case 0xdd: return arr(u32());
+                case 0xde: return map(u16());
+                case 0xdf: return map(u32());
+                }
+                throw new Error("msgpack: unsupported type 0x" + b.toString(16));
+            }
+            return read();
+        }
+
+        function msgpackEncode(value) {
+            const out = [];
+            const text = new TextEncoder();
+
+            function head(fix, fixMax, c8, c16, c32, n) {
+                if (n <= fixMax) {
+                    out.push(fix | n);
+                } else if (c8 && n <= 0xff) {
+                    out.push(c8, n);
+                } else if (n <= 0xffff) {
+                    out.push(c16, n >>> 8, n & 0xff);
+                } else {
+                    out.push(c32, n >>> 24, (n >>> 16) & 0xff, (n >>> 8) & 0xff, n & 0xff);
+                }
+            }
+            function write(v) {
+                if (v === null || v === undefined) {
+                    out.push(0xc0);
+                } else if (typeof v === "boolean") {
+                    out.push(v ? 0xc3 : 0xc2);
+                } else if (Number.isInteger(v) && v >= 0 && v <= 0xffffffff) {
+                    head(0x00, 0x7f, 0xcc, 0xcd, 0xce, v);
+                } else if (Number.isInteger(v) && v < 0 && v >= -32) {
+                    out.push(v & 0xff);
+                } else if (typeof v === "number") {
+                    const f = new DataView(new ArrayBuffer(8));
+                    f.setFloat64(0, v);
+                    out.push(0xcb, ...new Uint8Array(f.buffer));
+                } else if (typeof v === "string") {
+                    const b = text.encode(v);
+                    head(0xa0, 0x1f, 0xd9, 0xda, 0xdb, b.length);
+                    out.push(...b);
+                } else if (Array.isArray(v)) {
+                    head(0x90, 0x0f, 0, 0xdc, 0xdd, v.length);
+                    v.forEach(write);
+                } else {
+                    const keys = Object.keys(v);
+                    head(0x80, 0x0f, 0, 0xde, 0xdf, keys.length);
+                    keys.forEach(function(k) { write(k); write(v[k]); });
+                }
+            }
+            write(value);
+            return new Uint8Array(out);
+        }
+
+        function cborDecode(buf) {
+            const view = new DataView(buf);
+            const bytes = new Uint8Array(buf);
+            const text = new TextDecoder();
+            let pos = 0;
+
+            function length(info) {
+                let v;
+                switch (info) {
+                case 24: return bytes[pos++];
+                case 25: v = view.getUint16(pos); pos += 2; return v;
+                case 26: v = view.getUint32(pos); pos += 4; return v;
+                case 27: v = Number(view.getBigUint64(pos)); pos += 8; return v;
+                }
+                if (info < 24) {
+                    return info;
+                }
+                throw new Error("cbor: indefinite lengths are not supported");
+            }
+            function half(h) {
+                const exp = (h >>> 10) & 0x1f;
+                const frac = h & 0x3ff;
+                const sign = h & 0x8000 ? -1 : 1;
+                if (exp === 0) {
+                    return sign * Math.pow(2, -14) * (frac / 1024);
+                }
+                if (exp === 0x1f) {
+                    return frac ? NaN : sign * Infinity;
+                }
+                return sign * Math.pow(2, exp - 15) * (1 + frac / 1024);
+            }
+            function read() {
+                const b = bytes[pos++];
+                const info = b & 0x1f;
+                let n, v;
+                switch (b >>> 5) {
+                case 0: return length(info);
+                case 1: return -1 - length(info);
+                case 2: n = length(info); pos += n; return bytes.slice(pos - n, pos);
+                case 3: n = length(info); v = text.decode(bytes.subarray(pos, pos + n)); pos += n; return v;
+                case 4: n = length(info); v = []; for (let i = 0; i < n; i++) { v.push(read()); } return v;
+                case 5: n = length(info); v = {}; for (let i = 0; i < n; i++) { const k = read(); v[k] = read(); } return v;
+                case 6: length(info); return read(); // Tags are ignored.
+                }
+                switch (info) {
+                case 20: return false;
+                case 21: return true;
+                case 22: return null;
+                case 23: return undefined;
+                case 25: v = half(view.getUint16(pos)); pos += 2; return v;
+                case 26: v = view.getFloat32(pos); pos += 4; return v;
+                case 27: v = view.getFloat64(pos); pos += 8; return v;
+                }
+                throw new Error("cbor: unsupported simple value " + info);
+            }
+            return read();
+        }
+
+        function cborEncode(value) {
+            const out = [];
+            const text = new TextEncoder();
+
+            function head(major, n) {
+                if (n < 24) {
+                    out.push(major << 5 | n);
+                } else if (n <= 0xff) {
+                    out.push(major << 5 | 24, n);
+                } else if (n <= 0xffff) {
+                    out.push(major << 5 | 25, n >>> 8, n & 0xff);
+                } else {
+                    out.push(major << 5 | 26, n >>> 24, (n >>> 16) & 0xff, (n >>> 8) & 0xff, n & 0xff);
+                }
+            }
+            function write(v) {
+                if (v === null || v === undefined) {
+                    out.push(0xf6);
+                } else if (typeof v === "boolean") {
+                    out.push(v ? 0xf5 : 0xf4);
+                } else if (Number.isInteger(v) && Math.abs(v) <= 0xffffffff) {
+                    if (v >= 0) {
+                        head(0, v);
+                    } else {
+                        head(1, -1 - v);
+                    }
+                } else if (typeof v === "number") {
+                    const f = new DataView(new ArrayBuffer(8));
+                    f.setFloat64(0, v);
+                    out.push(0xfb, ...new Uint8Array(f.buffer));
+                } else if (typeof v === "string") {
+                    const b = text.encode(v);
+                    head(3, b.length);
+                    out.push(...b);
+                } else if (Array.isArray(v)) {
+                    head(4, v.length);
+                    v.forEach(write);
+                } else {
+                    const keys = Object.keys(v);
+                    head(5, keys.length);
+                    keys.forEach(function(k) { write(k); write(v[k]); });
+                }
+            }
+            write(value);
+            return new Uint8Array(out);
+        }
+
+        const codecs = {
+            json: {encode: JSON.stringify, decode: JSON.parse},
+            msgpack: {encode: msgpackEncode, decode: msgpackDecode},
+            cbor: {encode: cborEncode, decode: cborDecode},
+        };
+
+        // echoHeartbeat answers server heartbeats, it returns true for them.
+        function echoHeartbeat(data) {
+            try {
+                const message = codec.decode(data);
+                if (message.type !== "heartbeat") {
+                    return false;
+                }
+                ws.send(codec.encode({version: 1, type: "heartbeat", payload: {seq: message.payload.seq}}));
+                return true;
+            } catch (e) {
+                return false;
+            }
+        }
+
+        // formatNotice returns the text of operator notices and announcements,
+        // null for the other messages. Operators write their text, it is
+        // shown as text and never as HTML.
+        function formatNotice(data) {
+            try {
+                const message = codec.decode(data);
+                if (message.type !== "notice" && message.type !== "announcement") {
+                    return null;
+                }
+                const payload = message.payload || {};
+                let text = (message.type === "notice" ? "NOTICE: " : "ANNOUNCEMENT: ") + (payload.text || "");
+                if (payload.data !== undefined) {
+                    text += " " + JSON.stringify(payload.data);
+                }
+                return text;
+            } catch (e) {
+                return null;
+            }
+        }
+
         function formatResponse(data) {
             try {
-                const response = JSON.parse(data);
-                return `Iteration: ${response.iteration}, Hex Value: `+
-                       `<span class="hex-value">${response.value}</span>`;
+                const response = codec.decode(data);
+                if (response.type === "ack") {
+                    return "ACK #" + escapeHTML(response.id || "") +
+                           (response.payload ? " " + escapeHTML(JSON.stringify(response.payload)) : "");
+                }
+                if (response.type === "error") {
+                    return "ERROR #" + escapeHTML(response.id || "") + " " +
+                           escapeHTML(response.payload.code + ": " + response.payload.message);
+                }
+                return "Iteration: " + response.iteration + ", Hex Value: " +
+                       "<span class=\"hex-value\">" + response.value + "</span>";
             } catch (e) {
-                return data;
+                return escapeHTML("Undecodable message: " + e.message);
             }
         }
 
@@ -192,7 +493,9 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
             if (ws) {
                 return false;
             }
-            ws = new WebSocket({{.wsURL}});
+            codec = codecs[encodingSelect.value];
+            ws = new WebSocket({{.WSURL}}, [encodingSelect.value]);
+            ws.binaryType = "arraybuffer";
 
             ws.onopen = function(evt) {
                 print("sent", "Connection established");
@@ -206,9 +509,18 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
             }
 
             ws.onmessage = function(evt) {
+                if (echoHeartbeat(evt.data)) {
+                    return;
+                }
                 const msgDiv = document.createElement("div");
-                msgDiv.className = "message received";
-                msgDiv.innerHTML = formatResponse(evt.data);
+                const notice = formatNotice(evt.data);
+                if (notice !== null) {
+                    msgDiv.className = "message received notice";
+                    msgDiv.textContent = notice;
+                } else {
+                    msgDiv.className = "message received";
+                    msgDiv.innerHTML = formatResponse(evt.data);
+                }
                 output.appendChild(msgDiv);
                 output.scrollTop = output.scrollHeight;
             }
@@ -232,13 +544,14 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
             if (!ws) {
                 return false;
             }
-            print("sent", "Resetting counter");
-            ws.send("{}");
+            const command = {version: 1, type: "reset", id: String(++commandID)};
+            print("sent", "Resetting counter #" + command.id);
+            ws.send(codec.encode(command));
             return false;
         };
 
         // Add CSRF token to all requests
-        const csrfToken = {{.csrfToken}};
+        const csrfToken = {{.CSRFToken}};
         if (csrfToken) {
             const headers = new Headers({
                 'X-CSRF-Token': csrfToken
@@ -251,11 +564,11 @@ func (s *Server) handlerHome(w http.ResponseWriter, r *http.Request) {
 `))
 
 	data := struct {
-		wsURL     template.JS
-		csrfToken template.JS
+		WSURL     template.JS
+		CSRFToken template.JS
 	}{
-		wsURL:     template.JS(`"ws://" + window.location.host + "/goapp/ws"`),
-		csrfToken: template.JS(`"` + token + `"`),
+		WSURL:     template.JS(`"ws://" + window.location.host + "/goapp/ws"`),
+		CSRFToken: template.JS(`"` + token + `"`),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -0,0 +1,11 @@
+package httpsrv
+
+import (
+	"net/http"
+
+	"goapp/internal/pkg/metrics"
+)
+
+func (s *Server) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics.Handler().ServeHTTP(w, r)
+}
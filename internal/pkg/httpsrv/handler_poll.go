@@ -0,0 +1,328 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"goapp/internal/pkg/watcher"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	pollBufferSize     = 100              // Values buffered between polls.
+	pollDefaultTimeout = 25 * time.Second // Poll wait when the client sets none.
+	pollMaxTimeout     = 60 * time.Second // Longest poll wait a client can ask for.
+)
+
+type pollEntry struct {
+	cursor uint64
+	msg    wsMessage
+}
+
+type pollResponse struct {
+	Cursor   uint64      `json:"cursor"`
+	Messages []wsMessage `json:"messages"`
+	Notices  []envelope  `json:"notices,omitempty"`
+	Dropped  int64       `json:"dropped"`
+}
+
+// pollSession buffers the values of a long-polling session between polls. The
+// cursor numbers the buffered values, a poll returns the values after the
+// cursor the client has seen.
+type pollSession struct {
+	sess        *session
+	entries     []pollEntry   // Buffered values, oldest first.
+	cursor      uint64        // Cursor of the last buffered value.
+	delivered   uint64        // Highest cursor returned to the client.
+	dropped     int64         // Values dropped from a full buffer.
+	maxEntries  int           // Highest number of buffered values.
+	notices     []envelope    // Operator notices not returned yet.
+	closeReason string        // Set when an operator closes the session.
+	lastPoll    time.Time     // Last poll of the client.
+	wakeup      chan struct{} // Closed when a value or notice is buffered.
+	mu          sync.Mutex
+	quitChannel chan struct{} // Quit.
+	closeOnce   sync.Once
+}
+
+func newPollSession(sess *session) *pollSession {
+	return &pollSession{
+		sess:        sess,
+		lastPoll:    time.Now(),
+		wakeup:      make(chan struct{}),
+		quitChannel: make(chan struct{}),
+	}
+}
+
+func (ps *pollSession) push(counter *watcher.Counter) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.cursor++
+	ps.entries = append(ps.entries, pollEntry{
+		cursor: ps.cursor,
+		msg:    wsMessage{Iteration: counter.Iteration, Value: counter.Value},
+	})
+	if len(ps.entries) > pollBufferSize {
+		ps.entries = ps.entries[1:]
+		ps.dropped++
+	}
+	if len(ps.entries) > ps.maxEntries {
+		ps.maxEntries = len(ps.entries)
+	}
+
+	ps.wake()
+}
+
+// wake wakes the waiting polls, ps.mu must be held.
+func (ps *pollSession) wake() {
+	close(ps.wakeup)
+	ps.wakeup = make(chan struct{})
+}
+
+func (ps *pollSession) terminate(code int, reason string) {
+	ps.mu.Lock()
+	ps.closeReason = fmt.Sprintf("%s (%d)", reason, code)
+	ps.mu.Unlock()
+	ps.close()
+}
+
+// notify buffers a notice for the next poll.
+func (ps *pollSession) notify(n notice) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if len(ps.notices) >= pollBufferSize {
+		return false
+	}
+	ps.notices = append(ps.notices, newReply(n.typ, "", n.payload))
+	ps.wake()
+	return true
+}
+
+// since returns the buffered values after cursor and the pending notices, or
+// a channel closed when the next value is buffered if there are none. newly
+// is the number of values returned for the first time.
+func (ps *pollSession) since(cursor uint64) (resp pollResponse, newly int, wait <-chan struct{}) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.lastPoll = time.Now()
+	resp = pollResponse{Cursor: cursor, Messages: []wsMessage{}, Dropped: ps.dropped}
+
+	for _, e := range ps.entries {
+		if e.cursor <= cursor {
+			continue
+		}
+		resp.Messages = append(resp.Messages, e.msg)
+		resp.Cursor = e.cursor
+		if e.cursor > ps.delivered {
+			newly++
+		}
+	}
+	resp.Notices, ps.notices = ps.notices, nil
+	if resp.Cursor > ps.delivered {
+		ps.delivered = resp.Cursor
+	}
+
+	return resp, newly, ps.wakeup
+}
+
+func (ps *pollSession) idle(timeout time.Duration) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return time.Since(ps.lastPoll) > timeout
+}
+
+// closedError returns the error of the polls of a closed session.
+func (ps *pollSession) closedError() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closeReason != "" {
+		return fmt.Errorf("poll session closed: %s", ps.closeReason)
+	}
+	return fmt.Errorf("poll session closed")
+}
+
+func (ps *pollSession) close() {
+	ps.closeOnce.Do(func() { close(ps.quitChannel) })
+}
+
+// pollLoop buffers the session values until the session is deleted, expires
+// or the server stops.
+func (s *Server) pollLoop(ps *pollSession) {
+	defer s.running.Done()
+	defer s.removePollSession(ps)
+
+	ticker := time.NewTicker(s.cfg.PollIdleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case counter := <-ps.sess.watch.Recv():
+			if ps.sess.wantsValue(counter.Value) {
+				ps.push(counter)
+			}
+		case <-ticker.C:
+			if ps.idle(s.cfg.PollIdleTimeout) {
+				ps.sess.log.Info("poll session expired")
+				s.setCloseStats(ps.sess.id(), 0, "expired")
+				return
+			}
+		case <-ps.quitChannel:
+			s.setCloseStats(ps.sess.id(), 0, "deleted")
+			return
+		case <-s.ctx.Done():
+			s.setCloseStats(ps.sess.id(), 0, "server stopped")
+			return
+		}
+	}
+}
+
+func (s *Server) getPollSession(id string) *pollSession {
+	s.pollsLock.RLock()
+	defer s.pollsLock.RUnlock()
+	return s.polls[id]
+}
+
+func (s *Server) removePollSession(ps *pollSession) {
+	ps.close()
+
+	ps.mu.Lock()
+	s.observeQueueStats(ps.sess.id(), ps.maxEntries)
+	ps.mu.Unlock()
+
+	s.pollsLock.Lock()
+	delete(s.polls, ps.sess.id())
+	s.pollsLock.Unlock()
+
+	s.removeSession(ps.sess)
+}
+
+func (s *Server) handlerPollCreate(w http.ResponseWriter, r *http.Request) {
+	if s.isDraining() {
+		s.error(w, http.StatusServiceUnavailable, fmt.Errorf("server is shutting down"))
+		return
+	}
+
+	// Every poll session holds a watcher and a value buffer until it
+	// expires, the lock keeps the count under the limit.
+	s.pollsLock.Lock()
+	if max := s.cfg.MaxPollSessions; max > 0 && len(s.polls) >= max {
+		s.pollsLock.Unlock()
+		s.error(w, http.StatusServiceUnavailable, fmt.Errorf("too many poll sessions"))
+		return
+	}
+
+	sess, err := startSession(transportPoll, r.RemoteAddr)
+	if err != nil {
+		s.pollsLock.Unlock()
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	sess.setClient(r)
+	s.addSession(sess)
+
+	ps := newPollSession(sess)
+	sess.control.Store(ps)
+	s.polls[sess.id()] = ps
+	s.pollsLock.Unlock()
+
+	s.running.Add(1)
+	go s.pollLoop(ps)
+
+	s.writeJSON(w, http.StatusCreated, struct {
+		Session string `json:"session"`
+		Cursor  uint64 `json:"cursor"`
+	}{sess.id(), 0})
+}
+
+// handlerPoll returns the values after the cursor query parameter, waiting up
+// to the timeout query parameter (in seconds) for one to arrive.
+func (s *Server) handlerPoll(w http.ResponseWriter, r *http.Request) {
+	ps := s.getPollSession(mux.Vars(r)["id"])
+	if ps == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("unknown poll session"))
+		return
+	}
+
+	var (
+		cursor  uint64
+		timeout = pollDefaultTimeout
+		err     error
+	)
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		if cursor, err = strconv.ParseUint(v, 10, 64); err != nil {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("invalid cursor: %w", err))
+			return
+		}
+	}
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("invalid timeout %q", v))
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+		if timeout > pollMaxTimeout {
+			timeout = pollMaxTimeout
+		}
+	}
+
+	// Outlive the server write timeout while waiting.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 5*time.Second))
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		resp, newly, wait := ps.since(cursor)
+		if len(resp.Messages) > 0 || len(resp.Notices) > 0 {
+			for i := 0; i < newly; i++ {
+				s.incStats(ps.sess.id())
+			}
+			n := int64(s.writeJSON(w, http.StatusOK, resp))
+			s.addBytesStats(ps.sess.id(), n, n)
+			return
+		}
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			n := int64(s.writeJSON(w, http.StatusOK, resp))
+			s.addBytesStats(ps.sess.id(), n, n)
+			return
+		case <-ps.quitChannel:
+			s.error(w, http.StatusNotFound, ps.closedError())
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) handlerPollReset(w http.ResponseWriter, r *http.Request) {
+	ps := s.getPollSession(mux.Vars(r)["id"])
+	if ps == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("unknown poll session"))
+		return
+	}
+
+	s.resetSession(ps.sess)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlerPollDelete(w http.ResponseWriter, r *http.Request) {
+	ps := s.getPollSession(mux.Vars(r)["id"])
+	if ps == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("unknown poll session"))
+		return
+	}
+
+	ps.close()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/watcher"
+)
+
+func (c *testClient) create() string {
+	c.t.Helper()
+	w := c.do(http.MethodPost, "/goapp/poll", true)
+	if w.Code != http.StatusCreated {
+		c.t.Fatalf("got %d, want 201", w.Code)
+	}
+	var created struct {
+		Session string `json:"session"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		c.t.Fatal(err)
+	}
+	return created.Session
+}
+
+func (c *testClient) poll(id string, cursor uint64, timeout int) pollResponse {
+	c.t.Helper()
+	w := c.do(http.MethodGet, fmt.Sprintf("/goapp/poll/%s?cursor=%d&timeout=%d", id, cursor, timeout), false)
+	if w.Code != http.StatusOK {
+		c.t.Fatalf("got %d, want 200", w.Code)
+	}
+	var resp pollResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+// waitGone waits for the poll loop of a session to remove it.
+func (c *testClient) waitGone(id string) {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.s.getPollSession(id) != nil || c.s.getSession(id) != nil {
+		if time.Now().After(deadline) {
+			c.t.Fatal("timed out waiting for the poll session to close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPollSessions = 2
+	c := newTestClient(t, cfg)
+
+	if w := c.do(http.MethodPost, "/goapp/poll", false); w.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want 403 without a CSRF token", w.Code)
+	}
+	id := c.create()
+
+	if resp := c.poll(id, 0, 0); resp.Cursor != 0 || len(resp.Messages) != 0 {
+		t.Fatalf("got %+v, want no value yet", resp)
+	}
+
+	// The poll waits for the value.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c.s.notifySessions(broker.Message{Seq: 1, Value: "A1"})
+	}()
+	resp := c.poll(id, 0, 5)
+	if resp.Cursor != 1 || len(resp.Messages) != 1 || resp.Messages[0].Value != "A1" || resp.Messages[0].Iteration != 1 {
+		t.Fatalf("got %+v, want value A1 at cursor 1", resp)
+	}
+	// A poll from an older cursor returns the value again.
+	if resp := c.poll(id, 0, 0); resp.Cursor != 1 || len(resp.Messages) != 1 {
+		t.Fatalf("got %+v, want value A1 again", resp)
+	}
+	if resp := c.poll(id, 1, 0); resp.Cursor != 1 || len(resp.Messages) != 0 {
+		t.Fatalf("got %+v, want no value after cursor 1", resp)
+	}
+
+	// Values beyond the buffer are dropped, oldest first.
+	ps := c.s.getPollSession(id)
+	for i := 0; i < pollBufferSize+5; i++ {
+		ps.push(&watcher.Counter{Iteration: i + 2, Value: "B"})
+	}
+	resp = c.poll(id, 1, 0)
+	if len(resp.Messages) != pollBufferSize || resp.Dropped != 6 || resp.Cursor != pollBufferSize+6 {
+		t.Fatalf("got %d values, cursor %d and %d dropped, want %d values, cursor %d and 6 dropped",
+			len(resp.Messages), resp.Cursor, resp.Dropped, pollBufferSize, pollBufferSize+6)
+	}
+
+	if w := c.do(http.MethodPost, "/goapp/poll/"+id+"/reset", false); w.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want 403 without a CSRF token", w.Code)
+	}
+	if w := c.do(http.MethodPost, "/goapp/poll/"+id+"/reset", true); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d, want 204", w.Code)
+	}
+	if st := c.s.AllSessionStats(); len(st) != 1 || st[0].Resets != 1 {
+		t.Fatalf("got %+v, want one reset", st)
+	}
+
+	// Sessions over the limit are refused.
+	other := c.create()
+	if w := c.do(http.MethodPost, "/goapp/poll", true); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503 over %d sessions", w.Code, cfg.MaxPollSessions)
+	}
+
+	if w := c.do(http.MethodDelete, "/goapp/poll/"+other, false); w.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want 403 without a CSRF token", w.Code)
+	}
+	if w := c.do(http.MethodDelete, "/goapp/poll/"+other, true); w.Code != http.StatusNoContent {
+		t.Fatalf("got %d, want 204", w.Code)
+	}
+	c.waitGone(other)
+	if w := c.do(http.MethodGet, "/goapp/poll/"+other, false); w.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want 404 for a deleted session", w.Code)
+	}
+	c.create()
+}
+
+func TestPollExpiry(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PollIdleTimeout = 100 * time.Millisecond
+	c := newTestClient(t, cfg)
+
+	id := c.create()
+	c.waitGone(id)
+	if w := c.do(http.MethodGet, "/goapp/poll/"+id, false); w.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want 404 for an expired session", w.Code)
+	}
+}
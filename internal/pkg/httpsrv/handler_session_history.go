@@ -0,0 +1,118 @@
+package httpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"goapp/internal/pkg/sessiondb"
+	"goapp/internal/pkg/summary"
+)
+
+// historyDefaultRange is the time range of a history query without from.
+const historyDefaultRange = 24 * time.Hour
+
+type sessionHistory struct {
+	Sessions []summary.Record `json:"sessions"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Limit    int              `json:"limit"`
+}
+
+type sessionRollups struct {
+	Hours []sessiondb.HourRollup `json:"hours"`
+	Total sessiondb.Rollup       `json:"total"`
+	From  time.Time              `json:"from"`
+	To    time.Time              `json:"to"`
+}
+
+// handlerSessionHistory returns the ended sessions started within the from
+// and to query parameters, of the remoteAddr client and lasting at least
+// minDuration, oldest first.
+func (s *Server) handlerSessionHistory(w http.ResponseWriter, r *http.Request) {
+	if s.sessionDB == nil {
+		s.error(w, http.StatusNotImplemented, fmt.Errorf("session history is disabled"))
+		return
+	}
+	from, to, err := queryRange(r)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", sessionsDefaultLimit)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 || limit > sessionsMaxLimit {
+		limit = sessionsMaxLimit
+	}
+	var minDuration time.Duration
+	if v := r.URL.Query().Get("minDuration"); v != "" {
+		if minDuration, err = time.ParseDuration(v); err != nil {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("invalid minDuration: %w", err))
+			return
+		}
+	}
+
+	records, err := s.sessionDB.Sessions(sessiondb.Query{
+		From:        from,
+		To:          to,
+		RemoteAddr:  r.URL.Query().Get("remoteAddr"),
+		MinDuration: minDuration,
+		Limit:       limit,
+	})
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, sessionHistory{Sessions: records, From: from, To: to, Limit: limit})
+}
+
+// handlerSessionRollups returns the hourly rollups of the ended sessions
+// started within the from and to query parameters, and their total.
+func (s *Server) handlerSessionRollups(w http.ResponseWriter, r *http.Request) {
+	if s.sessionDB == nil {
+		s.error(w, http.StatusNotImplemented, fmt.Errorf("session history is disabled"))
+		return
+	}
+	from, to, err := queryRange(r)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hours, total, err := s.sessionDB.Hourly(from, to)
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, sessionRollups{Hours: hours, Total: total, From: from, To: to})
+}
+
+// queryRange returns the RFC 3339 from and to query parameters, to defaults
+// to now and from to historyDefaultRange before to.
+func queryRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+	from := to.Add(-historyDefaultRange)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
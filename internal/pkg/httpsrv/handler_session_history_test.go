@@ -0,0 +1,60 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionHistory(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Summary.Log = false
+	cfg.SessionDB = filepath.Join(t.TempDir(), "sessions.db")
+	c := newAdminClient(t, cfg)
+	s := c.s
+	if err := s.sessionDB.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.stopSessionDB()
+	if err := s.summaries.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range []string{"10.0.0.1:1000", "10.0.0.2:1000"} {
+		sess, err := s.OpenSession("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.Sent(10)
+		sess.Close()
+	}
+	// Stopping the recorder writes the queued summaries.
+	s.summaries.Stop()
+
+	if w := c.withPassword("").do(http.MethodGet, "/goapp/history/sessions", false); w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want 401 without credentials", w.Code)
+	}
+
+	w := c.do(http.MethodGet, "/goapp/history/sessions?remoteAddr=10.0.0.2", false)
+	var history sessionHistory
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Sessions) != 1 || history.Sessions[0].RemoteAddr != "10.0.0.2:1000" || history.Sessions[0].Sent != 1 {
+		t.Fatalf("got %+v, want the session of 10.0.0.2", history)
+	}
+
+	w = c.do(http.MethodGet, "/goapp/history/hourly", false)
+	var rollups sessionRollups
+	if err := json.NewDecoder(w.Body).Decode(&rollups); err != nil {
+		t.Fatal(err)
+	}
+	if rollups.Total.Sessions != 2 || rollups.Total.WireBytes != 20 || len(rollups.Hours) == 0 {
+		t.Fatalf("got %+v, want the two sessions", rollups)
+	}
+
+	if w := c.do(http.MethodGet, "/goapp/history/sessions?minDuration=soon", false); w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400 for an invalid duration", w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goapp/internal/pkg/logging"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	sessionsDefaultLimit = 100  // Sessions per page when the client sets no limit.
+	sessionsMaxLimit     = 1000 // Largest page a client can ask for.
+	noticeMaxSize        = 1 << 16
+)
+
+// sessionSummary is a session of the session list.
+type sessionSummary struct {
+	ID         string    `json:"id"`
+	Transport  string    `json:"transport"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Started    time.Time `json:"started"`
+	Sent       int64     `json:"sent"`
+	Resets     int64     `json:"resets"`
+}
+
+type sessionList struct {
+	Sessions []sessionSummary `json:"sessions"`
+	Total    int              `json:"total"`
+	Offset   int              `json:"offset"`
+	Limit    int              `json:"limit"`
+}
+
+// sessionDetails are the live details of a session.
+type sessionDetails struct {
+	sessionSummary
+	RawBytes  int64       `json:"rawBytes"`
+	WireBytes int64       `json:"wireBytes"`
+	Dropped   int64       `json:"dropped"`
+	Encoding  string      `json:"encoding"`
+	Paused    bool        `json:"paused"`
+	Topics    []string    `json:"topics"`
+	Filter    string      `json:"filter,omitempty"`
+	RTT       *rttPayload `json:"rtt,omitempty"`
+}
+
+func newSessionSummary(st SessionStats) sessionSummary {
+	return sessionSummary{
+		ID:         st.ID,
+		Transport:  st.Transport,
+		RemoteAddr: st.RemoteAddr,
+		Started:    st.Started,
+		Sent:       st.Sent,
+		Resets:     st.Resets,
+	}
+}
+
+// handlerSessions returns a page of the sessions of all transports, oldest
+// first, selected by the offset and limit query parameters.
+func (s *Server) handlerSessions(w http.ResponseWriter, r *http.Request) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", sessionsDefaultLimit)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit > sessionsMaxLimit {
+		limit = sessionsMaxLimit
+	}
+
+	all := s.AllSessionStats()
+	list := sessionList{Sessions: []sessionSummary{}, Total: len(all), Offset: offset, Limit: limit}
+	for i := offset; i < len(all) && i < offset+limit; i++ {
+		list.Sessions = append(list.Sessions, newSessionSummary(all[i]))
+	}
+
+	s.writeJSON(w, http.StatusOK, list)
+}
+
+// handlerSession returns the live details of a session.
+func (s *Server) handlerSession(w http.ResponseWriter, r *http.Request) {
+	sess := s.getSession(mux.Vars(r)["id"])
+	if sess == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("unknown session"))
+		return
+	}
+
+	st := s.sessionStats(sess)
+	d := sessionDetails{
+		sessionSummary: newSessionSummary(st),
+		RawBytes:       st.RawBytes,
+		WireBytes:      st.WireBytes,
+		Dropped:        st.Dropped,
+		Encoding:       sess.codec.Name(),
+		Paused:         sess.paused.Load(),
+		Topics:         sess.topicList(),
+	}
+	if filter := sess.filter.Load(); filter != nil {
+		d.Filter = filter.String()
+	}
+	if st.RTTSamples > 0 {
+		d.RTT = &rttPayload{
+			Samples: st.RTTSamples,
+			Min:     milliseconds(st.RTTMin),
+			Avg:     milliseconds(st.RTTAvg),
+			P99:     milliseconds(st.RTTP99),
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, d)
+}
+
+// handlerSessionClose closes a session with the close code and reason query
+// parameters.
+func (s *Server) handlerSessionClose(w http.ResponseWriter, r *http.Request) {
+	code, err := queryInt(r, "code", closeCodeDefault)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if !validCloseCode(code) {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("invalid close code %d", code))
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = closeReasonDefault
+	}
+	if len(reason) > closeReasonMax {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("reason longer than %d bytes", closeReasonMax))
+		return
+	}
+
+	control, ok := s.sessionControl(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	slog.InfoContext(r.Context(), "session closed by an administrator", logging.KeySession, mux.Vars(r)["id"], "remote_addr", r.RemoteAddr, "code", code, "reason", reason)
+	s.setCloseStats(mux.Vars(r)["id"], code, reason)
+	control.terminate(code, reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionMessage sends a notice to a session.
+func (s *Server) handlerSessionMessage(w http.ResponseWriter, r *http.Request) {
+	var payload noticePayload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, noticeMaxSize)).Decode(&payload); err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("invalid notice: %w", err))
+		return
+	}
+	if payload.Text == "" && payload.Data == nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("notice needs a text or data"))
+		return
+	}
+	payload.Time = time.Now().UTC()
+
+	control, ok := s.sessionControl(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	if !control.notify(notice{typ: msgNotice, payload: payload}) {
+		s.error(w, http.StatusServiceUnavailable, fmt.Errorf("session queue is full"))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sessionControl returns the control of session id, writing the error
+// response when there is none.
+func (s *Server) sessionControl(w http.ResponseWriter, id string) (sessionControl, bool) {
+	sess := s.getSession(id)
+	if sess == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("unknown session"))
+		return nil, false
+	}
+	control := sess.controller()
+	if control == nil {
+		s.error(w, http.StatusNotImplemented, fmt.Errorf("%s sessions can't be controlled", sess.transport))
+		return nil, false
+	}
+	return control, true
+}
+
+// queryInt returns the non-negative integer query parameter name, def when
+// it is not set.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return n, nil
+}
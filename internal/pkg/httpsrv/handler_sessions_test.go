@@ -0,0 +1,110 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionsAPI(t *testing.T) {
+	c := newAdminClient(t, DefaultConfig())
+	s := c.s
+
+	for i := 0; i < 3; i++ {
+		sess, err := s.OpenSession(transportPoll, fmt.Sprintf("127.0.0.1:%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sess.Close()
+		sess.Sent(1)
+	}
+
+	get := func(url string) *httptest.ResponseRecorder {
+		return c.do(http.MethodGet, url, false)
+	}
+
+	if w := c.withPassword("wrong").do(http.MethodGet, "/goapp/sessions", false); w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d, want 401 with a wrong password", w.Code)
+	}
+
+	w := get("/goapp/sessions?offset=1&limit=1")
+	var list sessionList
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 3 || len(list.Sessions) != 1 || list.Sessions[0].RemoteAddr != "127.0.0.1:1" || list.Sessions[0].Sent != 1 {
+		t.Fatalf("got %+v, want the second of 3 sessions", list)
+	}
+
+	w = get("/goapp/sessions/" + list.Sessions[0].ID)
+	var d sessionDetails
+	if err := json.NewDecoder(w.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != list.Sessions[0].ID || d.Transport != transportPoll || d.Encoding != "json" {
+		t.Fatalf("got %+v, want the details of %s", d, list.Sessions[0].ID)
+	}
+
+	if w := get("/goapp/sessions/unknown"); w.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want 404 for an unknown session", w.Code)
+	}
+	if w := get("/goapp/sessions?limit=-1"); w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400 for a negative limit", w.Code)
+	}
+}
+
+func TestSessionControl(t *testing.T) {
+	c := newAdminClient(t, DefaultConfig())
+	s := c.s
+
+	sess := newSession(transportPoll, "127.0.0.1:1")
+	ps := newPollSession(sess)
+	sess.control.Store(ps)
+	s.addSession(sess)
+	defer s.removeSession(sess)
+
+	grpc, err := s.OpenSession("grpc", "127.0.0.1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpc.Close()
+
+	do := func(method, url, body string) int {
+		return c.doBody(method, url, body, true).Code
+	}
+
+	if w := c.doBody(http.MethodPost, "/goapp/sessions/"+sess.id()+"/messages", `{"text":"hello"}`, false); w.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want 403 without a CSRF token", w.Code)
+	}
+
+	if code := do(http.MethodPost, "/goapp/sessions/"+sess.id()+"/messages", `{}`); code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400 for an empty notice", code)
+	}
+	if code := do(http.MethodPost, "/goapp/sessions/"+sess.id()+"/messages", `{"text":"hello"}`); code != http.StatusAccepted {
+		t.Fatalf("got %d, want 202", code)
+	}
+	resp, _, _ := ps.since(0)
+	if len(resp.Notices) != 1 || resp.Notices[0].Type != msgNotice || resp.Notices[0].Payload.(noticePayload).Text != "hello" {
+		t.Fatalf("got %+v, want the hello notice", resp.Notices)
+	}
+
+	if code := do(http.MethodDelete, "/goapp/sessions/"+grpc.ID(), ""); code != http.StatusNotImplemented {
+		t.Fatalf("got %d, want 501 for a grpc session", code)
+	}
+	if code := do(http.MethodDelete, "/goapp/sessions/"+sess.id()+"?code=2000", ""); code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400 for close code 2000", code)
+	}
+	if code := do(http.MethodDelete, "/goapp/sessions/"+sess.id()+"?code=4000&reason=bye", ""); code != http.StatusNoContent {
+		t.Fatalf("got %d, want 204", code)
+	}
+	select {
+	case <-ps.quitChannel:
+	default:
+		t.Fatal("poll session not closed")
+	}
+	if err := ps.closedError(); err.Error() != "poll session closed: bye (4000)" {
+		t.Fatalf("got %v, want the close reason", err)
+	}
+}
@@ -0,0 +1,179 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goapp/internal/pkg/watcher"
+)
+
+const (
+	sseRetry        = 3 * time.Second  // Reconnect delay advised to the client.
+	sseKeepAlive    = 15 * time.Second // Comment sent on idle streams to keep proxies from closing them.
+	sseWriteTimeout = 10 * time.Second // Deadline for a single event write.
+)
+
+// sseEventClose is the event sent when an operator ends the stream.
+const sseEventClose = "close"
+
+// handlerSSE streams the counter values as Server-Sent Events. The event ID
+// is the value sequence, so a reconnecting EventSource resumes from the
+// values kept in the history.
+func (s *Server) handlerSSE(w http.ResponseWriter, r *http.Request) {
+	lastSeq, resume, err := lastEventID(r)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("invalid last event ID: %w", err))
+		return
+	}
+
+	if s.isDraining() {
+		s.error(w, http.StatusServiceUnavailable, fmt.Errorf("server is shutting down"))
+		return
+	}
+
+	sess, err := startSession(transportSSE, r.RemoteAddr)
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	sess.setClient(r)
+	defer sess.labelGoroutine(r.Context())()
+
+	var missed []watcher.Counter
+	if resume {
+		missed = s.resumeSession(sess, lastSeq)
+	} else {
+		s.addSession(sess)
+	}
+	defer s.removeSession(sess)
+	// Unless another cause was recorded.
+	defer s.setCloseStats(sess.id(), 0, "write failed")
+
+	control := &sseControl{
+		closed:  make(chan sseClose, 1),
+		notices: make(chan notice, outReplySize),
+	}
+	sess.control.Store(control)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	write := func(event string) error {
+		rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		n, err := io.WriteString(w, event)
+		if err != nil {
+			return err
+		}
+		s.addBytesStats(sess.id(), int64(n), int64(n))
+		return rc.Flush()
+	}
+	writeValue := func(counter *watcher.Counter) error {
+		data, err := json.Marshal(wsMessage{Iteration: counter.Iteration, Value: counter.Value})
+		if err != nil {
+			return err
+		}
+		if err := write(fmt.Sprintf("id: %d\ndata: %s\n\n", counter.Seq, data)); err != nil {
+			return err
+		}
+		s.incStats(sess.id())
+		return nil
+	}
+
+	writeEvent := func(event string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return write(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+	}
+
+	if err := write(fmt.Sprintf("retry: %d\n\n", sseRetry.Milliseconds())); err != nil {
+		return
+	}
+
+	for i := range missed {
+		if err := writeValue(&missed[i]); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			s.setCloseStats(sess.id(), 0, "client disconnected")
+			return
+		case <-s.drainChannel:
+			// EventSource clients reconnect on their own.
+			s.setCloseStats(sess.id(), 0, drainReason)
+			return
+		case <-ticker.C:
+			if err := write(": keep-alive\n\n"); err != nil {
+				return
+			}
+		case c := <-control.closed:
+			writeEvent(sseEventClose, c)
+			return
+		case n := <-control.notices:
+			if err := writeEvent(n.typ, n.payload); err != nil {
+				return
+			}
+		case counter := <-sess.watch.Recv():
+			if err := writeValue(counter); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sseClose is the data of the close event sent before the server ends a
+// stream.
+type sseClose struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// sseControl closes and notifies an SSE session.
+type sseControl struct {
+	closed  chan sseClose
+	notices chan notice
+}
+
+func (c *sseControl) terminate(code int, reason string) {
+	select {
+	case c.closed <- sseClose{Code: code, Reason: reason}:
+	default:
+	}
+}
+
+func (c *sseControl) notify(n notice) bool {
+	select {
+	case c.notices <- n:
+		return true
+	default:
+		return false
+	}
+}
+
+// lastEventID returns the sequence a client resumes from, taken from the
+// Last-Event-ID header or the lastEventId query parameter.
+func lastEventID(r *http.Request) (uint64, bool, error) {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("lastEventId")
+	}
+	if id == "" {
+		return 0, false, nil
+	}
+	seq, err := strconv.ParseUint(id, 10, 64)
+	return seq, err == nil, err
+}
@@ -0,0 +1,176 @@
+package httpsrv
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+)
+
+// sseEvent is an event of an SSE stream.
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// sseStream reads the events of an SSE response.
+type sseStream struct {
+	t    *testing.T
+	resp *http.Response
+	r    *bufio.Reader
+}
+
+func openSSE(t *testing.T, ctx context.Context, url, lastEventID string) *sseStream {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return &sseStream{t: t, resp: resp, r: bufio.NewReader(resp.Body)}
+}
+
+// next returns the next event carrying data, skipping the retry field and
+// comments.
+func (s *sseStream) next() sseEvent {
+	s.t.Helper()
+	var ev sseEvent
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if ev.data != "" {
+				return ev
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = value
+		}
+	}
+}
+
+// value returns the next value event, with its ID.
+func (s *sseStream) value() (string, string) {
+	s.t.Helper()
+	ev := s.next()
+	var msg wsMessage
+	if err := json.Unmarshal([]byte(ev.data), &msg); err != nil || ev.event != "" {
+		s.t.Fatalf("got event %+v, want a value", ev)
+	}
+	return ev.id, msg.Value
+}
+
+func TestSSE(t *testing.T) {
+	s := New(DefaultConfig(), broker.NewLocal())
+	srv := httptest.NewServer(http.HandlerFunc(s.handlerSSE))
+	defer srv.Close()
+
+	publish := func(seq uint64, value string) broker.Message {
+		m := broker.Message{Seq: seq, Value: value, Time: time.Now()}
+		s.history.add(m)
+		return m
+	}
+	// live publishes a value and reads it from stream. Watchers drop the
+	// values sent while they are busy, so the value is handed to the sessions
+	// until read, watchers ignore the sequences they already counted.
+	live := func(stream *sseStream, seq uint64, value string) {
+		t.Helper()
+		m := publish(seq, value)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				s.notifySessions(m)
+				select {
+				case <-done:
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}()
+		if id, got := stream.value(); id != fmt.Sprint(seq) || got != value {
+			t.Fatalf("got event %s %s, want %d %s", id, got, seq, value)
+		}
+	}
+	// waitSessions waits for n SSE sessions having sent sent values.
+	waitSessions := func(n int, sent int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			all := s.AllSessionStats()
+			if len(all) == n && (n == 0 || (all[0].Transport == transportSSE && all[0].Sent == sent)) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got sessions %+v, want %d SSE sessions having sent %d values", all, n, sent)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	stream := openSSE(t, ctx, srv.URL, "")
+	waitSessions(1, 0)
+
+	for i, value := range []string{"A1", "B2", "C3"} {
+		live(stream, uint64(i+1), value)
+	}
+	waitSessions(1, 3)
+
+	cancel()
+	stream.resp.Body.Close()
+	waitSessions(0, 0)
+
+	// Values published while disconnected are replayed from the history,
+	// then the stream goes on live.
+	publish(4, "D4")
+	publish(5, "E5")
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream = openSSE(t, ctx, srv.URL, "3")
+	defer stream.resp.Body.Close()
+
+	for _, want := range []struct{ id, value string }{{"4", "D4"}, {"5", "E5"}} {
+		if id, value := stream.value(); id != want.id || value != want.value {
+			t.Fatalf("got event %s %s, want %s %s", id, value, want.id, want.value)
+		}
+	}
+	live(stream, 6, "F6")
+	waitSessions(1, 3)
+
+	resp, err := http.Get(srv.URL + "?lastEventId=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400 for an invalid last event ID", resp.StatusCode)
+	}
+}
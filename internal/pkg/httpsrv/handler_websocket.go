@@ -2,79 +2,128 @@ package httpsrv
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
+	"goapp/internal/pkg/codec"
+	"goapp/internal/pkg/logging"
+	"goapp/internal/pkg/metrics"
 	"goapp/internal/pkg/watcher"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	wsWriteWait  = 10 * time.Second // Deadline of a frame write.
+	wsPongWait   = 60 * time.Second // Read deadline, extended by pongs.
+	wsPingPeriod = 54 * time.Second // Ping interval, shorter than wsPongWait.
+	wsReadLimit  = 512              // Maximum size of a client message.
+	wsTimeLimit  = 5 * time.Minute  // Lifetime of a session.
+)
+
 type wsMessage struct {
 	Iteration int    `json:"iteration"`
 	Value     string `json:"value"`
 }
 
 func (s *Server) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	if s.epoll != nil {
+		s.handlerWebSocketEpoll(w, r)
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(r.Context(), wsTimeLimit)
 	defer cancel()
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
 
 	if !s.isValidOrigin(r.Header.Get("Origin")) {
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonOrigin).Inc()
 		s.error(w, http.StatusForbidden, fmt.Errorf("invalid origin"))
 		return
 	}
 
-	watch := watcher.New()
-	if err := watch.Start(); err != nil {
-		s.error(w, http.StatusInternalServerError, fmt.Errorf("failed to start watcher: %w", err))
+	if !s.beginWebSocket() {
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonDraining).Inc()
+		s.error(w, http.StatusServiceUnavailable, fmt.Errorf("server is shutting down"))
 		return
 	}
-	defer watch.Stop()
+	defer s.endWebSocket()
 
-	s.addWatcher(watch)
-	defer s.removeWatcher(watch)
+	sess, err := startSession(transportWebSocket, r.RemoteAddr)
+	if err != nil {
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonSession).Inc()
+		s.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	sess.setClient(r)
+	defer sess.labelGoroutine(r.Context())()
+	s.addSession(sess)
+	defer s.removeSession(sess)
 
 	upgrader := websocket.Upgrader{
-		HandshakeTimeout: 10 * time.Second,
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+		HandshakeTimeout:  10 * time.Second,
+		ReadBufferSize:    s.cfg.ReadBufferSize,
+		WriteBufferSize:   s.cfg.WriteBufferSize,
+		EnableCompression: s.cfg.Compression,
+		Subprotocols:      append(codec.Names(), subprotocolJSONRPC),
 		CheckOrigin: func(r *http.Request) bool {
 			return s.isValidOrigin(r.Header.Get("Origin"))
 		},
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	cw := &countingResponseWriter{ResponseWriter: w}
+	span := startUpgradeSpan(r.Context(), EngineGoroutine)
+	conn, err := upgrader.Upgrade(cw, r, nil)
 	if err != nil {
+		endUpgradeSpan(span, "", err)
+		metrics.HandshakeFailures.WithLabelValues(metrics.ReasonUpgrade).Inc()
 		s.error(w, http.StatusInternalServerError, fmt.Errorf("websocket upgrade failed: %w", err))
 		return
 	}
 	defer conn.Close()
+	endUpgradeSpan(span, conn.Subprotocol(), nil)
+
+	if err := conn.SetCompressionLevel(s.cfg.CompressionLevel); err != nil {
+		sess.log.Warn("websocket compression level", logging.Err(err))
+	}
+
+	// JSON-RPC sessions are JSON encoded.
+	sess.protocol = conn.Subprotocol()
+	rpc := sess.protocol == subprotocolJSONRPC
+	if rpc {
+		sess.codec = codec.JSON
+	} else {
+		sess.codec = codec.Lookup(conn.Subprotocol())
+	}
+	sess.wire = cw.conn
 
-	conn.SetReadLimit(512)
-	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
 	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
 		return nil
 	})
 
+	// The writer goroutine is the only one writing to the connection.
+	out := newOutQueue()
+	out.onDrop = func() { s.addDropStats(sess.id()) }
+	sess.control.Store(&wsControl{out: out, rpc: rpc, cancel: cancel})
+	writerDone := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(54 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if err := conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
-					return
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
+		defer close(writerDone)
+		defer cancel()
+		s.writeLoop(ctx, conn, sess, out)
+	}()
+	defer func() {
+		cancel()
+		<-writerDone
+		_, maxDepth := out.stats()
+		s.observeQueueStats(sess.id(), maxDepth)
+		// Unless a close frame or another cause was recorded.
+		s.setCloseStats(sess.id(), websocket.CloseAbnormalClosure, "connection closed")
 	}()
 
 	go func() {
@@ -82,46 +131,202 @@ func (s *Server) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
 		for {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
+				var closeErr *websocket.CloseError
+				switch {
+				case errors.As(err, &closeErr):
+					s.setCloseStats(sess.id(), closeErr.Code, closeErr.Text)
+				case errors.Is(err, websocket.ErrReadLimit):
+					s.setCloseStats(sess.id(), websocket.CloseMessageTooBig, "message too big")
+				}
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-					log.Printf("websocket read error: %v", err)
+					sess.log.Warn("websocket read error", logging.Err(err))
 				}
 				return
 			}
+			s.addReceivedStats(sess.id(), int64(len(message)))
 
-			var reset watcher.CounterReset
-			if err := json.Unmarshal(message, &reset); err != nil {
-				log.Printf("invalid message format: %v", err)
+			var reply interface{}
+			if rpc {
+				reply = s.handleRPC(sess, message)
+			} else if env := s.handleMessage(sess, message); env.Type != "" {
+				reply = env
+			}
+			if reply == nil {
 				continue
 			}
 
-			watch.ResetCounter()
+			if !out.push(prioReply, outFrame{v: reply}) {
+				sess.log.Warn("reply queue full, closing")
+				s.setCloseStats(sess.id(), websocket.CloseAbnormalClosure, "reply queue full")
+				return
+			}
 		}
 	}()
 
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	var heartbeatC <-chan time.Time
+	if s.cfg.HeartbeatInterval > 0 {
+		heartbeatTicker := time.NewTicker(s.cfg.HeartbeatInterval)
+		defer heartbeatTicker.Stop()
+		heartbeatC = heartbeatTicker.C
+	}
+
+	drainCh := s.drainChannel
 	for {
 		select {
 		case <-ctx.Done():
+			switch {
+			case s.ctx.Err() != nil:
+				s.setCloseStats(sess.id(), websocket.CloseAbnormalClosure, "server stopped")
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				s.setCloseStats(sess.id(), websocket.CloseAbnormalClosure, "session time limit")
+			}
 			return
-		case counter := <-watch.Recv():
-			msg := wsMessage{
-				Iteration: counter.Iteration,
-				Value:     counter.Value,
+		case <-drainCh:
+			// The client answers the close, or the server stops at the drain deadline.
+			drainCh = nil
+			s.setCloseStats(sess.id(), websocket.CloseGoingAway, drainReason)
+			out.push(prioControl, outFrame{
+				messageType: websocket.CloseMessage,
+				data:        websocket.FormatCloseMessage(websocket.CloseGoingAway, drainReason),
+			})
+		case <-ticker.C:
+			out.push(prioControl, outFrame{messageType: websocket.PingMessage})
+		case <-heartbeatC:
+			// Heartbeats skip the queued values so the round trip is not queueing time.
+			out.push(prioControl, heartbeatFrame(sess, rpc))
+		case counter := <-sess.watch.Recv():
+			if !sess.wantsValue(counter.Value) {
+				continue
 			}
+			out.push(prioValue, valueFrame(*counter, rpc))
+		}
+	}
+}
 
-			data, err := json.Marshal(msg)
-			if err != nil {
-				log.Printf("json marshal error: %v", err)
-				return
-			}
+// wsControl closes and notifies a session of the goroutine engine.
+type wsControl struct {
+	out    *outQueue
+	rpc    bool
+	cancel context.CancelFunc
+}
+
+func (c *wsControl) terminate(code int, reason string) {
+	c.out.push(prioControl, outFrame{
+		messageType: websocket.CloseMessage,
+		data:        websocket.FormatCloseMessage(code, reason),
+	})
+	time.AfterFunc(closeGrace, c.cancel)
+}
+
+func (c *wsControl) notify(n notice) bool {
+	return c.out.push(prioReply, n.frame(c.rpc))
+}
+
+// heartbeatFrame returns the next heartbeat of the session.
+func heartbeatFrame(sess *session, rpc bool) outFrame {
+	seq, sent := sess.heartbeat.next()
+	p := heartbeatPayload{Seq: seq, Time: &sent}
+	var v interface{} = newReply(cmdHeartbeat, "", p)
+	if rpc {
+		v = rpcNotification{JSONRPC: jsonrpcVersion, Method: rpcNotifyHeartbeat, Params: p}
+	}
+	return outFrame{v: v}
+}
+
+// valueFrame returns the message delivering a counted value.
+func valueFrame(counter watcher.Counter, rpc bool) outFrame {
+	msg := wsMessage{
+		Iteration: counter.Iteration,
+		Value:     counter.Value,
+	}
+
+	var v interface{} = msg
+	if rpc {
+		v = newRPCValue(msg)
+	}
+	return outFrame{v: v, value: true}
+}
+
+// writeLoop writes the queued frames, most urgent first, until ctx is done or
+// a write fails. Nothing is written after a close frame.
+func (s *Server) writeLoop(ctx context.Context, conn *websocket.Conn, sess *session, out *outQueue) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-out.ready():
+		}
 
-			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		for f, ok := out.pop(); ok; f, ok = out.pop() {
+			if err := s.writeFrame(conn, sess, f); err != nil {
 				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					log.Printf("websocket write error: %v", err)
+					sess.log.Warn("websocket write error", logging.Err(err))
 				}
 				return
 			}
-
-			s.incStats(watch.GetWatcherId())
+			if f.messageType == websocket.CloseMessage {
+				<-ctx.Done()
+				return
+			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+// writeFrame writes a queued frame within the write deadline.
+func (s *Server) writeFrame(conn *websocket.Conn, sess *session, f outFrame) error {
+	start := time.Now()
+	defer observeWrite(EngineGoroutine, f, start)
+
+	deadline := start.Add(wsWriteWait)
+	if f.messageType == websocket.PingMessage || f.messageType == websocket.CloseMessage {
+		return conn.WriteControl(f.messageType, f.data, deadline)
+	}
+
+	conn.SetWriteDeadline(deadline)
+	if err := s.writeMessage(conn, sess, f.v); err != nil {
+		return err
+	}
+	if f.value {
+		s.incStats(sess.id())
+	}
+	return nil
+}
+
+// observeWrite records the latency of a frame write started at start.
+func observeWrite(engine string, f outFrame, start time.Time) {
+	frame := "message"
+	switch {
+	case f.value:
+		frame = "value"
+	case f.v == nil:
+		frame = "control"
+	}
+	metrics.WriteLatency.WithLabelValues(engine, frame).Observe(time.Since(start).Seconds())
+}
+
+// writeMessage encodes v with the session codec and writes it as a text or
+// binary frame, compressed when it reaches the compression threshold.
+func (s *Server) writeMessage(conn *websocket.Conn, sess *session, v interface{}) error {
+	data, err := sess.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%s marshal error: %w", sess.codec.Name(), err)
+	}
+
+	messageType := websocket.TextMessage
+	if sess.codec.Binary() {
+		messageType = websocket.BinaryMessage
+	}
+
+	conn.EnableWriteCompression(len(data) >= s.cfg.CompressionMin)
+
+	written := sess.wire.written.Load()
+	if err := conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	s.addBytesStats(sess.id(), int64(len(data)), sess.wire.written.Load()-written)
+
+	return nil
+}
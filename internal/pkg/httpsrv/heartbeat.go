@@ -0,0 +1,86 @@
+package httpsrv
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	heartbeatPending = 8   // Unanswered heartbeats kept per session.
+	rttSamples       = 128 // Recent round trips kept for the p99.
+)
+
+// heartbeat numbers the heartbeats sent to a session and matches the echoes
+// of the client to measure the round trip.
+type heartbeat struct {
+	seq     uint64
+	pending map[uint64]time.Time // Send time by heartbeat sequence.
+	mu      sync.Mutex
+}
+
+// next returns the sequence and time of a new heartbeat.
+func (h *heartbeat) next() (uint64, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.pending == nil {
+		h.pending = make(map[uint64]time.Time)
+	}
+	h.seq++
+	now := time.Now()
+	h.pending[h.seq] = now
+	delete(h.pending, h.seq-heartbeatPending)
+	return h.seq, now
+}
+
+// ack matches the echo of heartbeat seq and returns its round trip.
+func (h *heartbeat) ack(seq uint64) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sent, exists := h.pending[seq]
+	if !exists {
+		return 0, false
+	}
+	delete(h.pending, seq)
+	return time.Since(sent), true
+}
+
+// rttStats summarizes the heartbeat round trips of a session.
+type rttStats struct {
+	count  int64
+	min    time.Duration
+	sum    time.Duration
+	recent []time.Duration // Ring of the last rttSamples round trips.
+	next   int
+}
+
+func (r *rttStats) add(d time.Duration) {
+	if r.count == 0 || d < r.min {
+		r.min = d
+	}
+	r.count++
+	r.sum += d
+
+	if len(r.recent) < rttSamples {
+		r.recent = append(r.recent, d)
+		return
+	}
+	r.recent[r.next] = d
+	r.next = (r.next + 1) % rttSamples
+}
+
+// summary returns the minimum and average of all round trips and the 99th
+// percentile of the recent ones.
+func (r *rttStats) summary() (min, avg, p99 time.Duration) {
+	if r.count == 0 {
+		return 0, 0, 0
+	}
+
+	sorted := append([]time.Duration(nil), r.recent...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := (len(sorted)*99+99)/100 - 1
+
+	return r.min, r.sum / time.Duration(r.count), sorted[i]
+}
@@ -0,0 +1,48 @@
+package httpsrv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatAck(t *testing.T) {
+	var h heartbeat
+
+	first, _ := h.next()
+	for i := 0; i < heartbeatPending; i++ {
+		h.next()
+	}
+
+	if _, ok := h.ack(first); ok {
+		t.Fatal("evicted heartbeat acknowledged")
+	}
+	if _, ok := h.ack(first + 1); !ok {
+		t.Fatal("pending heartbeat not acknowledged")
+	}
+	if _, ok := h.ack(first + 1); ok {
+		t.Fatal("heartbeat acknowledged twice")
+	}
+}
+
+func TestRTTSummary(t *testing.T) {
+	var r rttStats
+	if min, avg, p99 := r.summary(); min != 0 || avg != 0 || p99 != 0 {
+		t.Fatal("empty summary not zero")
+	}
+
+	for i := 1; i <= 100; i++ {
+		r.add(time.Duration(i) * time.Millisecond)
+	}
+	min, avg, p99 := r.summary()
+	if min != time.Millisecond || avg != 50500*time.Microsecond || p99 != 99*time.Millisecond {
+		t.Fatalf("got min %s, avg %s, p99 %s", min, avg, p99)
+	}
+
+	// The p99 follows the recent samples.
+	for i := 0; i < rttSamples; i++ {
+		r.add(time.Millisecond)
+	}
+	if _, _, p99 := r.summary(); p99 != time.Millisecond {
+		t.Fatalf("got p99 %s over recent samples", p99)
+	}
+}
@@ -0,0 +1,59 @@
+package httpsrv
+
+import (
+	"sync"
+
+	"goapp/internal/pkg/broker"
+)
+
+// history keeps the most recent broker messages so clients can resume a
+// stream from the last sequence they have seen.
+type history struct {
+	msgs []broker.Message // Ring buffer.
+	next int              // Index of the next write.
+	full bool             // Ring buffer wrapped around.
+	mu   sync.RWMutex
+}
+
+func newHistory(size int) *history {
+	if size < 0 {
+		size = 0
+	}
+	return &history{msgs: make([]broker.Message, size)}
+}
+
+func (h *history) add(m broker.Message) {
+	if len(h.msgs) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.msgs[h.next] = m
+	h.next = (h.next + 1) % len(h.msgs)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// since returns the kept messages with a sequence greater than seq, oldest
+// first.
+func (h *history) since(seq uint64) []broker.Message {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var ordered []broker.Message
+	if h.full {
+		ordered = append(ordered, h.msgs[h.next:]...)
+	}
+	ordered = append(ordered, h.msgs[:h.next]...)
+
+	var msgs []broker.Message
+	for _, m := range ordered {
+		if m.Seq > seq {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
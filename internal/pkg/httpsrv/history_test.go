@@ -0,0 +1,43 @@
+package httpsrv
+
+import (
+	"testing"
+
+	"goapp/internal/pkg/broker"
+)
+
+func TestHistorySince(t *testing.T) {
+	h := newHistory(3)
+	if got := h.since(0); len(got) != 0 {
+		t.Fatalf("empty history returned %v", got)
+	}
+
+	for seq := uint64(1); seq <= 5; seq++ {
+		h.add(broker.Message{Seq: seq})
+	}
+
+	tests := []struct {
+		name string
+		seq  uint64
+		want []uint64
+	}{
+		{"before kept values", 0, []uint64{3, 4, 5}},
+		{"within kept values", 3, []uint64{4, 5}},
+		{"latest value", 5, nil},
+		{"after latest value", 9, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.since(tt.seq)
+			if len(got) != len(tt.want) {
+				t.Fatalf("since(%d) = %v, want seqs %v", tt.seq, got, tt.want)
+			}
+			for i := range got {
+				if got[i].Seq != tt.want[i] {
+					t.Errorf("since(%d)[%d].Seq = %d, want %d", tt.seq, i, got[i].Seq, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package httpsrv
+
+import (
+	"sort"
+	"time"
+
+	"goapp/internal/pkg/watcher"
+)
+
+// Session is a hub session served by a transport outside of this package, it
+// receives the same values and shares the statistics of the HTTP sessions.
+type Session struct {
+	s    *Server
+	sess *session
+}
+
+// SessionStats are the statistics of a session.
+type SessionStats struct {
+	ID         string
+	Transport  string
+	RemoteAddr string
+	Started    time.Time
+	Sent       int64 // Values sent.
+	RawBytes   int64 // Message bytes before compression.
+	WireBytes  int64 // Bytes written to the connection.
+	Resets     int64 // Counter resets.
+	Dropped    int64 // Values dropped from a full outbound queue.
+	RTTSamples int64 // Heartbeat round trips measured.
+	RTTMin     time.Duration
+	RTTAvg     time.Duration
+	RTTP99     time.Duration // Over the recent round trips.
+}
+
+// OpenSession adds a session served over transport to the hub, Close() must
+// be called at the end.
+func (s *Server) OpenSession(transport, remoteAddr string) (*Session, error) {
+	sess, err := startSession(transport, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	s.addSession(sess)
+	return &Session{s: s, sess: sess}, nil
+}
+
+func (ss *Session) ID() string { return ss.sess.id() }
+
+// Values returns the counters of the values received by the session.
+func (ss *Session) Values() <-chan *watcher.Counter {
+	return ss.sess.watch.Recv()
+}
+
+// Reset resets the session counter to zero.
+func (ss *Session) Reset() {
+	ss.s.resetSession(ss.sess)
+}
+
+// Sent counts a value of n bytes written to the client.
+func (ss *Session) Sent(n int) {
+	ss.s.incStats(ss.sess.id())
+	ss.s.addBytesStats(ss.sess.id(), int64(n), int64(n))
+}
+
+// Received counts n bytes of client messages.
+func (ss *Session) Received(n int) {
+	ss.s.addReceivedStats(ss.sess.id(), int64(n))
+}
+
+// SetUserAgent records the client software, before the session ends.
+func (ss *Session) SetUserAgent(userAgent string) {
+	ss.sess.userAgent = userAgent
+}
+
+// SetCloseReason records why the session ends, unless a cause was recorded
+// already.
+func (ss *Session) SetCloseReason(reason string) {
+	ss.s.setCloseStats(ss.sess.id(), 0, reason)
+}
+
+// Close removes the session from the hub.
+func (ss *Session) Close() {
+	ss.s.removeSession(ss.sess)
+}
+
+// ResetSession resets the counter of the session id of any transport. It
+// returns false when the session does not exist.
+func (s *Server) ResetSession(id string) bool {
+	sess := s.getSession(id)
+	if sess == nil {
+		return false
+	}
+	s.resetSession(sess)
+	return true
+}
+
+// SessionStats returns the statistics of the session id of any transport.
+func (s *Server) SessionStats(id string) (SessionStats, bool) {
+	sess := s.getSession(id)
+	if sess == nil {
+		return SessionStats{}, false
+	}
+	return s.sessionStats(sess), true
+}
+
+// AllSessionStats returns the statistics of all sessions, oldest first.
+func (s *Server) AllSessionStats() []SessionStats {
+	s.sessionsLock.RLock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.sessionsLock.RUnlock()
+
+	all := make([]SessionStats, 0, len(sessions))
+	for _, sess := range sessions {
+		all = append(all, s.sessionStats(sess))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].Started.Equal(all[j].Started) {
+			return all[i].Started.Before(all[j].Started)
+		}
+		return all[i].ID < all[j].ID
+	})
+	return all
+}
+
+func (s *Server) sessionStats(sess *session) SessionStats {
+	st := SessionStats{
+		ID:         sess.id(),
+		Transport:  sess.transport,
+		RemoteAddr: sess.remoteAddr,
+		Started:    sess.started,
+	}
+	if stats := s.stats.getStats(sess.id()); stats != nil {
+		st.Sent = stats.sent
+		st.RawBytes = stats.rawBytes
+		st.WireBytes = stats.wireBytes
+		st.Resets = stats.resets
+		st.Dropped = stats.dropped
+		st.RTTSamples = stats.rtt.count
+		st.RTTMin, st.RTTAvg, st.RTTP99 = stats.rtt.summary()
+	}
+	return st
+}
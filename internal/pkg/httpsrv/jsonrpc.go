@@ -0,0 +1,166 @@
+package httpsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// subprotocolJSONRPC is the WebSocket subprotocol speaking JSON-RPC 2.0
+// instead of the command envelope.
+const subprotocolJSONRPC = "jsonrpc-2.0"
+
+const jsonrpcVersion = "2.0"
+
+// Notification methods sent by the server.
+const (
+	rpcNotifyValue     = "value"
+	rpcNotifyHeartbeat = "heartbeat"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// rpcMethods maps JSON-RPC methods to the envelope commands executing them.
+var rpcMethods = map[string]string{
+	"subscribe":   cmdSubscribe,
+	"unsubscribe": cmdUnsubscribe,
+	"reset":       cmdReset,
+	"getStats":    cmdStats,
+	"setFilter":   cmdFilter,
+	"heartbeat":   cmdHeartbeat,
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"` // Absent for notifications.
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// rpcNull is the ID of responses to requests whose ID could not be read.
+var rpcNull = json.RawMessage("null")
+
+func newRPCValue(msg wsMessage) rpcNotification {
+	return rpcNotification{JSONRPC: jsonrpcVersion, Method: rpcNotifyValue, Params: msg}
+}
+
+func newRPCError(id json.RawMessage, code int, err error) *rpcResponse {
+	return &rpcResponse{JSONRPC: jsonrpcVersion, Error: &rpcError{Code: code, Message: err.Error()}, ID: id}
+}
+
+// handleRPC executes a JSON-RPC request or batch and returns the response to
+// send back, nil when there is none.
+func (s *Server) handleRPC(sess *session, data []byte) interface{} {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return newRPCError(rpcNull, rpcParseError, err)
+		}
+		if len(batch) == 0 {
+			return newRPCError(rpcNull, rpcInvalidRequest, fmt.Errorf("empty batch"))
+		}
+
+		var responses []*rpcResponse
+		for _, raw := range batch {
+			if resp := s.handleRPCRequest(sess, raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return responses
+	}
+
+	if resp := s.handleRPCRequest(sess, data); resp != nil {
+		return resp
+	}
+	return nil
+}
+
+// handleRPCRequest executes a single JSON-RPC request by running the matching
+// envelope command. Notifications are executed without a response.
+func (s *Server) handleRPCRequest(sess *session, data []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return newRPCError(rpcNull, rpcParseError, err)
+		}
+		return newRPCError(rpcNull, rpcInvalidRequest, err)
+	}
+
+	id := req.ID
+	if id == nil {
+		id = rpcNull
+	}
+	if req.JSONRPC != jsonrpcVersion || req.Method == "" {
+		return newRPCError(id, rpcInvalidRequest, fmt.Errorf("not a JSON-RPC 2.0 request"))
+	}
+
+	resp := s.callRPC(sess, req)
+	if req.ID == nil {
+		return nil
+	}
+	resp.ID = id
+	return resp
+}
+
+func (s *Server) callRPC(sess *session, req rpcRequest) *rpcResponse {
+	cmdType, exists := rpcMethods[req.Method]
+	if !exists {
+		return newRPCError(nil, rpcMethodNotFound, fmt.Errorf("unknown method %q", req.Method))
+	}
+
+	var params interface{}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return newRPCError(nil, rpcInvalidParams, err)
+		}
+		if _, byName := params.(map[string]interface{}); !byName {
+			return newRPCError(nil, rpcInvalidParams, fmt.Errorf("params must be an object"))
+		}
+	}
+
+	reply := s.handleCommand(sess, envelope{Type: cmdType, Payload: params})
+	if reply.Type == replyError {
+		p := reply.Payload.(errorPayload)
+		code := rpcInternalError
+		if p.Code == errInvalidPayload {
+			code = rpcInvalidParams
+		}
+		return &rpcResponse{JSONRPC: jsonrpcVersion, Error: &rpcError{Code: code, Message: p.Message, Data: p.Code}}
+	}
+
+	result := reply.Payload
+	if result == nil {
+		result = struct{}{}
+	}
+	return &rpcResponse{JSONRPC: jsonrpcVersion, Result: result}
+}
@@ -0,0 +1,64 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"testing"
+
+	"goapp/internal/pkg/broker"
+)
+
+func TestHandleRPC(t *testing.T) {
+	s := New(DefaultConfig(), broker.NewLocal())
+	sess, err := startSession(transportWebSocket, "127.0.0.1:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.watch.Stop()
+
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"call", `{"jsonrpc":"2.0","method":"unsubscribe","params":{"topic":"values"},"id":1}`,
+			`{"jsonrpc":"2.0","result":{"topic":"values"},"id":1}`},
+		{"notification", `{"jsonrpc":"2.0","method":"reset"}`,
+			`null`},
+		{"no params", `{"jsonrpc":"2.0","method":"reset","id":"a"}`,
+			`{"jsonrpc":"2.0","result":{},"id":"a"}`},
+		{"unknown method", `{"jsonrpc":"2.0","method":"pause","id":2}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"unknown method \"pause\""},"id":2}`},
+		{"invalid filter", `{"jsonrpc":"2.0","method":"setFilter","params":{"pattern":"("},"id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"error parsing regexp: missing closing ): ` + "`(`" + `","data":"invalid_payload"},"id":3}`},
+		{"positional params", `{"jsonrpc":"2.0","method":"setFilter","params":["^A"],"id":4}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"params must be an object"},"id":4}`},
+		{"not jsonrpc", `{"method":"reset","id":5}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"not a JSON-RPC 2.0 request"},"id":5}`},
+		{"parse error", `{"jsonrpc"`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"unexpected end of JSON input"},"id":null}`},
+		{"batch", `[{"jsonrpc":"2.0","method":"setFilter","params":{"pattern":"^A"},"id":6},{"jsonrpc":"2.0","method":"reset"}]`,
+			`[{"jsonrpc":"2.0","result":{"pattern":"^A"},"id":6}]`},
+		{"notification batch", `[{"jsonrpc":"2.0","method":"reset"}]`,
+			`null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(s.handleRPC(sess, []byte(tt.request)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if sess.subscribed(topicValues) {
+		t.Fatal("session should be unsubscribed")
+	}
+	sess.subscribe(topicValues)
+	if sess.wantsValue("B1") || !sess.wantsValue("A1") {
+		t.Fatal("filter ^A not applied")
+	}
+}
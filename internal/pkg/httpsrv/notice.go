@@ -0,0 +1,54 @@
+package httpsrv
+
+import (
+	"time"
+)
+
+// Operator message types, delivered apart from the generated values.
+const (
+	msgNotice       = "notice"       // Sent to a single session.
+	msgAnnouncement = "announcement" // Broadcast to all the sessions or a topic.
+)
+
+const (
+	closeCodeDefault   = 1008 // Policy violation.
+	closeReasonDefault = "closed by an administrator"
+	closeReasonMax     = 123 // Close frame payload less the status code.
+	closeGrace         = time.Second
+)
+
+type noticePayload struct {
+	Text string      `json:"text,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+	Time time.Time   `json:"time"`
+}
+
+// notice is a message from the operators.
+type notice struct {
+	typ     string
+	payload noticePayload
+}
+
+// frame returns the notice as a WebSocket message of the session protocol.
+func (n notice) frame(rpc bool) outFrame {
+	var v interface{} = newReply(n.typ, "", n.payload)
+	if rpc {
+		v = rpcNotification{JSONRPC: jsonrpcVersion, Method: n.typ, Params: n.payload}
+	}
+	return outFrame{v: v}
+}
+
+// sessionControl lets the admin API act on a session. It is set by the
+// transports supporting it.
+type sessionControl interface {
+	// terminate ends the session with a WebSocket close code and reason, the
+	// client is given closeGrace to answer.
+	terminate(code int, reason string)
+	// notify sends a notice, it returns false when the session can't take it.
+	notify(n notice) bool
+}
+
+// validCloseCode reports whether an operator can close a session with code.
+func validCloseCode(code int) bool {
+	return code == 1000 || code == 1001 || code == 1008 || (code >= 3000 && code <= 4999)
+}
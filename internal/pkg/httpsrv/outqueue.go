@@ -0,0 +1,120 @@
+package httpsrv
+
+import (
+	"sync"
+)
+
+// Priorities of outbound frames, highest first.
+const (
+	prioControl = iota // Pings and close frames.
+	prioReply          // Replies to client commands.
+	prioValue          // Generated values.
+	numPriorities
+)
+
+// Outbound queue limits per priority.
+const (
+	outControlSize = 4  // Pending control frames.
+	outReplySize   = 16 // Pending replies, the session is closed when exceeded.
+	outValueSize   = 32 // Pending values, the oldest is dropped when exceeded.
+)
+
+// outFrame is a frame waiting to be written to a WebSocket connection.
+type outFrame struct {
+	messageType int         // websocket message type.
+	data        []byte      // Payload of control frames.
+	v           interface{} // Message encoded with the session codec otherwise.
+	value       bool        // Counted as a delivered value.
+}
+
+// outQueue is the outbound queue of a WebSocket connection. Producers push
+// frames by priority, the writer goroutine pops the most urgent one, so
+// control frames and replies never wait behind a backlog of values.
+type outQueue struct {
+	lanes    [numPriorities][]outFrame
+	dropped  int64  // Values dropped from a full lane.
+	maxDepth int    // Highest number of queued frames.
+	onDrop   func() // Called for every dropped value, may be nil.
+	notify   chan struct{}
+	mu       sync.Mutex
+}
+
+func newOutQueue() *outQueue {
+	return &outQueue{notify: make(chan struct{}, 1)}
+}
+
+var outLaneSize = [numPriorities]int{outControlSize, outReplySize, outValueSize}
+
+// push queues a frame. A full value lane drops its oldest value, it returns
+// false when another lane is full.
+func (q *outQueue) push(prio int, f outFrame) bool {
+	q.mu.Lock()
+	lane := q.lanes[prio]
+	dropped := false
+	if len(lane) >= outLaneSize[prio] {
+		if prio != prioValue {
+			q.mu.Unlock()
+			return false
+		}
+		lane = lane[1:]
+		q.dropped++
+		dropped = true
+	}
+	q.lanes[prio] = append(lane, f)
+	if depth := q.depthLocked(); depth > q.maxDepth {
+		q.maxDepth = depth
+	}
+	q.mu.Unlock()
+
+	if dropped && q.onDrop != nil {
+		q.onDrop()
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop returns the most urgent frame, false when the queue is empty.
+func (q *outQueue) pop() (outFrame, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for prio := range q.lanes {
+		if lane := q.lanes[prio]; len(lane) > 0 {
+			f := lane[0]
+			lane[0] = outFrame{}
+			q.lanes[prio] = lane[1:]
+			return f, true
+		}
+	}
+	return outFrame{}, false
+}
+
+// ready is signalled when frames are pushed.
+func (q *outQueue) ready() <-chan struct{} {
+	return q.notify
+}
+
+func (q *outQueue) stats() (dropped int64, maxDepth int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped, q.maxDepth
+}
+
+// depth returns the number of queued frames.
+func (q *outQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depthLocked()
+}
+
+func (q *outQueue) depthLocked() int {
+	depth := 0
+	for _, lane := range q.lanes {
+		depth += len(lane)
+	}
+	return depth
+}
@@ -0,0 +1,33 @@
+package httpsrv
+
+import (
+	"testing"
+)
+
+func TestOutQueue(t *testing.T) {
+	q := newOutQueue()
+
+	for i := 0; i < outValueSize+2; i++ {
+		q.push(prioValue, outFrame{v: i, value: true})
+	}
+	q.push(prioReply, outFrame{v: "reply"})
+	q.push(prioControl, outFrame{v: "ping"})
+
+	for _, want := range []interface{}{"ping", "reply", 2, 3} {
+		f, ok := q.pop()
+		if !ok || f.v != want {
+			t.Fatalf("got %v, want %v", f.v, want)
+		}
+	}
+
+	if dropped, maxDepth := q.stats(); dropped != 2 || maxDepth != outValueSize+2 {
+		t.Fatalf("got %d dropped, max depth %d", dropped, maxDepth)
+	}
+
+	for i := 0; i < outReplySize; i++ {
+		q.push(prioReply, outFrame{})
+	}
+	if q.push(prioReply, outFrame{}) {
+		t.Fatal("full reply lane accepted a frame")
+	}
+}
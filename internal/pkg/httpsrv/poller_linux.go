@@ -0,0 +1,64 @@
+package httpsrv
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Events a connection is armed for. One-shot events are disabled once
+// reported, until the connection is armed again.
+const (
+	pollRead   = syscall.EPOLLIN | syscall.EPOLLRDHUP // Readable or closed by the client.
+	pollWrite  = syscall.EPOLLOUT                     // Writable again after a short write.
+	pollFailed = syscall.EPOLLHUP | syscall.EPOLLERR  // Reported whatever the connection is armed for.
+)
+
+// poller reports the readable and writable connections of the epoll engine.
+type poller struct {
+	fd     int
+	events []syscall.EpollEvent
+}
+
+func newPoller() (*poller, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return &poller{fd: fd, events: make([]syscall.EpollEvent, 128)}, nil
+}
+
+// add arms connection fd for events, reported with its generation gen.
+func (p *poller) add(fd int, gen uint32, events uint32) error {
+	ev := syscall.EpollEvent{Events: events | syscall.EPOLLONESHOT, Fd: int32(fd), Pad: int32(gen)}
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_ADD, fd, &ev)
+}
+
+// rearm arms connection fd again after its one-shot event.
+func (p *poller) rearm(fd int, gen uint32, events uint32) error {
+	ev := syscall.EpollEvent{Events: events | syscall.EPOLLONESHOT, Fd: int32(fd), Pad: int32(gen)}
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_MOD, fd, &ev)
+}
+
+func (p *poller) remove(fd int) error {
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_DEL, fd, &syscall.EpollEvent{})
+}
+
+// wait waits up to timeout milliseconds and calls ready for every connection
+// with events.
+func (p *poller) wait(timeout int, ready func(fd int, gen uint32, events uint32)) error {
+	n, err := syscall.EpollWait(p.fd, p.events, timeout)
+	if err != nil {
+		if errors.Is(err, syscall.EINTR) {
+			return nil
+		}
+		return err
+	}
+	for _, ev := range p.events[:n] {
+		ready(int(ev.Fd), uint32(ev.Pad), ev.Events)
+	}
+	return nil
+}
+
+func (p *poller) close() error {
+	return syscall.Close(p.fd)
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package httpsrv
+
+import (
+	"errors"
+)
+
+// Events a connection is armed for, unused without epoll.
+const (
+	pollRead   = 1
+	pollWrite  = 2
+	pollFailed = 4
+)
+
+// poller is only implemented on Linux.
+type poller struct{}
+
+func newPoller() (*poller, error) {
+	return nil, errors.New("the epoll engine is only supported on Linux")
+}
+
+func (p *poller) add(fd int, gen uint32, events uint32) error             { return nil }
+func (p *poller) rearm(fd int, gen uint32, events uint32) error           { return nil }
+func (p *poller) remove(fd int) error                                     { return nil }
+func (p *poller) wait(timeout int, ready func(int, uint32, uint32)) error { return nil }
+func (p *poller) close() error                                            { return nil }
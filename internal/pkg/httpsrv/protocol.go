@@ -0,0 +1,234 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// protocolVersion is the version of the WebSocket command envelope.
+const protocolVersion = 1
+
+// Command types sent by the client.
+const (
+	cmdReset       = "reset"
+	cmdPause       = "pause"
+	cmdSubscribe   = "subscribe"
+	cmdUnsubscribe = "unsubscribe"
+	cmdPing        = "ping"
+	cmdStats       = "stats"
+	cmdFilter      = "filter"
+	cmdHeartbeat   = "heartbeat"
+)
+
+// Reply types sent by the server.
+const (
+	replyAck   = "ack"
+	replyError = "error"
+)
+
+// Error codes of error replies.
+const (
+	errInvalidMessage     = "invalid_message"
+	errUnsupportedVersion = "unsupported_version"
+	errUnknownType        = "unknown_type"
+	errInvalidPayload     = "invalid_payload"
+)
+
+const (
+	maxTopicLength  = 64
+	maxTopics       = 16 // Topics a session can subscribe to.
+	maxFilterLength = 256
+)
+
+// envelope wraps commands sent by the client and the replies to them. A reply
+// carries the ID of the command it answers. Payload is decoded generically so
+// the envelope works with every codec.
+type envelope struct {
+	Version int         `json:"version,omitempty"`
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+type errorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type pausePayload struct {
+	Paused *bool `json:"paused"`
+}
+
+type topicPayload struct {
+	Topic string `json:"topic"`
+}
+
+type filterPayload struct {
+	Pattern string `json:"pattern"`
+}
+
+type pingPayload struct {
+	Time time.Time `json:"time"`
+}
+
+// heartbeatPayload is sent by the server with the send time and echoed by the
+// client with the same sequence.
+type heartbeatPayload struct {
+	Seq  uint64     `json:"seq"`
+	Time *time.Time `json:"time,omitempty"`
+}
+
+type statsPayload struct {
+	ID        string      `json:"id"`
+	Sent      int64       `json:"sent"`
+	RawBytes  int64       `json:"rawBytes"`
+	WireBytes int64       `json:"wireBytes"`
+	Paused    bool        `json:"paused"`
+	Topics    []string    `json:"topics"`
+	RTT       *rttPayload `json:"rtt,omitempty"`
+}
+
+// rttPayload are the heartbeat round trips in milliseconds.
+type rttPayload struct {
+	Samples int64   `json:"samples"`
+	Min     float64 `json:"minMs"`
+	Avg     float64 `json:"avgMs"`
+	P99     float64 `json:"p99Ms"`
+}
+
+func newReply(typ, id string, payload interface{}) envelope {
+	return envelope{Version: protocolVersion, Type: typ, ID: id, Payload: payload}
+}
+
+func newError(id, code string, err error) envelope {
+	return newReply(replyError, id, errorPayload{Code: code, Message: err.Error()})
+}
+
+// handleMessage decodes a client command with the session codec, executes it
+// and returns the reply to send back.
+func (s *Server) handleMessage(sess *session, data []byte) envelope {
+	var cmd envelope
+	if err := sess.codec.Unmarshal(data, &cmd); err != nil {
+		return newError("", errInvalidMessage, err)
+	}
+	return s.handleCommand(sess, cmd)
+}
+
+// handleCommand executes a client command on the session and returns the
+// reply to send back, a reply without type when there is none.
+func (s *Server) handleCommand(sess *session, cmd envelope) envelope {
+	if cmd.Version != 0 && cmd.Version != protocolVersion {
+		return newError(cmd.ID, errUnsupportedVersion, fmt.Errorf("version %d is not supported", cmd.Version))
+	}
+
+	switch cmd.Type {
+	case cmdReset:
+		s.resetSession(sess)
+		return newReply(replyAck, cmd.ID, nil)
+
+	case cmdPause:
+		p := pausePayload{}
+		if err := decodePayload(cmd.Payload, &p); err != nil {
+			return newError(cmd.ID, errInvalidPayload, err)
+		}
+		paused := p.Paused == nil || *p.Paused
+		sess.paused.Store(paused)
+		return newReply(replyAck, cmd.ID, pausePayload{Paused: &paused})
+
+	case cmdSubscribe, cmdUnsubscribe:
+		p := topicPayload{}
+		if err := decodePayload(cmd.Payload, &p); err != nil {
+			return newError(cmd.ID, errInvalidPayload, err)
+		}
+		if p.Topic == "" || len(p.Topic) > maxTopicLength {
+			return newError(cmd.ID, errInvalidPayload, fmt.Errorf("topic must be 1 to %d bytes", maxTopicLength))
+		}
+		if cmd.Type == cmdSubscribe {
+			if !sess.subscribe(p.Topic) {
+				return newError(cmd.ID, errInvalidPayload, fmt.Errorf("at most %d topics per session", maxTopics))
+			}
+		} else {
+			sess.unsubscribe(p.Topic)
+		}
+		return newReply(replyAck, cmd.ID, p)
+
+	case cmdPing:
+		return newReply(replyAck, cmd.ID, pingPayload{Time: time.Now()})
+
+	case cmdStats:
+		p := statsPayload{
+			ID:     sess.id(),
+			Paused: sess.paused.Load(),
+			Topics: sess.topicList(),
+		}
+		if stats := s.stats.getStats(sess.id()); stats != nil {
+			p.Sent = stats.sent
+			p.RawBytes = stats.rawBytes
+			p.WireBytes = stats.wireBytes
+			if stats.rtt.count > 0 {
+				min, avg, p99 := stats.rtt.summary()
+				p.RTT = &rttPayload{
+					Samples: stats.rtt.count,
+					Min:     milliseconds(min),
+					Avg:     milliseconds(avg),
+					P99:     milliseconds(p99),
+				}
+			}
+		}
+		return newReply(replyAck, cmd.ID, p)
+
+	case cmdFilter:
+		p := filterPayload{}
+		if err := decodePayload(cmd.Payload, &p); err != nil {
+			return newError(cmd.ID, errInvalidPayload, err)
+		}
+		if len(p.Pattern) > maxFilterLength {
+			return newError(cmd.ID, errInvalidPayload, fmt.Errorf("pattern longer than %d bytes", maxFilterLength))
+		}
+		if p.Pattern == "" {
+			sess.filter.Store(nil)
+			return newReply(replyAck, cmd.ID, p)
+		}
+		filter, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return newError(cmd.ID, errInvalidPayload, err)
+		}
+		sess.filter.Store(filter)
+		return newReply(replyAck, cmd.ID, p)
+
+	case cmdHeartbeat:
+		p := heartbeatPayload{}
+		if err := decodePayload(cmd.Payload, &p); err != nil {
+			return newError(cmd.ID, errInvalidPayload, err)
+		}
+		// Echoes are not answered, late ones are ignored.
+		if rtt, ok := sess.heartbeat.ack(p.Seq); ok {
+			s.addRTTStats(sess.id(), rtt)
+		}
+		return envelope{}
+
+	case "":
+		return newError(cmd.ID, errInvalidMessage, fmt.Errorf("missing type"))
+
+	default:
+		return newError(cmd.ID, errUnknownType, fmt.Errorf("unknown type %q", cmd.Type))
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// decodePayload converts a generically decoded payload into v.
+func decodePayload(payload interface{}, v interface{}) error {
+	if payload == nil {
+		return nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,138 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"goapp/internal/pkg/broker"
+)
+
+func TestHandleCommand(t *testing.T) {
+	s := New(DefaultConfig(), broker.NewLocal())
+	sess, err := startSession(transportWebSocket, "127.0.0.1:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.addSession(sess)
+	defer s.removeSession(sess)
+
+	topic := func(topic interface{}) map[string]interface{} {
+		return map[string]interface{}{"topic": topic}
+	}
+
+	// The commands run in order on the same session, want is the reply type
+	// and code the error code or the ack payload.
+	tests := []struct {
+		name string
+		cmd  envelope
+		want string
+		code string
+	}{
+		{"reset", envelope{Type: cmdReset, ID: "1"},
+			replyAck, ``},
+		{"pause", envelope{Type: cmdPause, ID: "2"},
+			replyAck, `{"paused":true}`},
+		{"resume", envelope{Type: cmdPause, ID: "3", Payload: map[string]interface{}{"paused": false}},
+			replyAck, `{"paused":false}`},
+		{"pause invalid payload", envelope{Type: cmdPause, ID: "4", Payload: map[string]interface{}{"paused": "yes"}},
+			replyError, errInvalidPayload},
+		{"subscribe", envelope{Type: cmdSubscribe, ID: "5", Payload: topic("news")},
+			replyAck, `{"topic":"news"}`},
+		{"subscribe without topic", envelope{Type: cmdSubscribe, ID: "6"},
+			replyError, errInvalidPayload},
+		{"subscribe long topic", envelope{Type: cmdSubscribe, ID: "7", Payload: topic(strings.Repeat("a", maxTopicLength+1))},
+			replyError, errInvalidPayload},
+		{"subscribe topic not a string", envelope{Type: cmdSubscribe, ID: "8", Payload: topic(1)},
+			replyError, errInvalidPayload},
+		{"subscribe payload not an object", envelope{Type: cmdSubscribe, ID: "9", Payload: "news"},
+			replyError, errInvalidPayload},
+		{"unsubscribe", envelope{Type: cmdUnsubscribe, ID: "10", Payload: topic("news")},
+			replyAck, `{"topic":"news"}`},
+		{"ping", envelope{Type: cmdPing, ID: "11"},
+			replyAck, ``},
+		{"stats", envelope{Type: cmdStats, ID: "12"},
+			replyAck, ``},
+		{"version 1", envelope{Version: protocolVersion, Type: cmdPing, ID: "13"},
+			replyAck, ``},
+		{"unsupported version", envelope{Version: 2, Type: cmdPing, ID: "14"},
+			replyError, errUnsupportedVersion},
+		{"unknown type", envelope{Type: "foo", ID: "15"},
+			replyError, errUnknownType},
+		{"missing type", envelope{ID: "16"},
+			replyError, errInvalidMessage},
+		{"heartbeat echo", envelope{Type: cmdHeartbeat, ID: "17", Payload: map[string]interface{}{"seq": 1}},
+			"", ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := s.handleCommand(sess, tt.cmd)
+			if reply.Type != tt.want {
+				t.Fatalf("got reply %+v, want type %q", reply, tt.want)
+			}
+			if reply.Type == "" {
+				return
+			}
+			if reply.ID != tt.cmd.ID || reply.Version != protocolVersion {
+				t.Fatalf("got id %q version %d, want id %q version %d", reply.ID, reply.Version, tt.cmd.ID, protocolVersion)
+			}
+
+			switch {
+			case reply.Type == replyError:
+				if code := reply.Payload.(errorPayload).Code; code != tt.code {
+					t.Fatalf("got code %s, want %s", code, tt.code)
+				}
+			case tt.code != "":
+				got, err := json.Marshal(reply.Payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.code {
+					t.Fatalf("got payload %s, want %s", got, tt.code)
+				}
+			}
+		})
+	}
+
+	reply := s.handleCommand(sess, envelope{Type: cmdStats})
+	if p := reply.Payload.(statsPayload); p.ID != sess.id() || p.Paused || len(p.Topics) != 1 || p.Topics[0] != topicValues {
+		t.Fatalf("got stats %+v, want the resumed session subscribed to values", p)
+	}
+
+	if reply := s.handleMessage(sess, []byte(`{"type":`)); reply.Type != replyError || reply.Payload.(errorPayload).Code != errInvalidMessage {
+		t.Fatalf("got reply %+v, want invalid_message", reply)
+	}
+}
+
+func TestSubscribeLimit(t *testing.T) {
+	s := New(DefaultConfig(), broker.NewLocal())
+	sess, err := startSession(transportWebSocket, "127.0.0.1:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.watch.Stop()
+
+	subscribe := func(typ, topic string) envelope {
+		return s.handleCommand(sess, envelope{Type: typ, Payload: map[string]interface{}{"topic": topic}})
+	}
+
+	// Sessions start subscribed to values.
+	for i := 1; i < maxTopics; i++ {
+		if reply := subscribe(cmdSubscribe, fmt.Sprint("topic", i)); reply.Type != replyAck {
+			t.Fatalf("got reply %+v for topic %d, want ack", reply, i)
+		}
+	}
+	if reply := subscribe(cmdSubscribe, "one more"); reply.Type != replyError {
+		t.Fatalf("got reply %+v, want an error over %d topics", reply, maxTopics)
+	}
+	if reply := subscribe(cmdSubscribe, "topic1"); reply.Type != replyAck {
+		t.Fatalf("got reply %+v, want ack for a subscribed topic", reply)
+	}
+
+	subscribe(cmdUnsubscribe, "topic1")
+	if reply := subscribe(cmdSubscribe, "one more"); reply.Type != replyAck {
+		t.Fatalf("got reply %+v, want ack after an unsubscribe", reply)
+	}
+}
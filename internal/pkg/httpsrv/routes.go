@@ -22,12 +22,120 @@ func (s *Server) myRoutes() []Route {
 			Pattern: "/goapp/health",
 			HFunc:   s.handlerWrapper(s.handlerHealth),
 		},
+		{
+			Name:    "broadcast",
+			Method:  "POST",
+			Pattern: "/goapp/broadcast",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerBroadcast)),
+		},
+		{
+			Name:    "metrics",
+			Method:  "GET",
+			Pattern: "/goapp/metrics",
+			HFunc:   s.handlerWrapper(s.handlerMetrics),
+		},
+		{
+			Name:    "sessions",
+			Method:  "GET",
+			Pattern: "/goapp/sessions",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerSessions)),
+		},
+		{
+			Name:    "session",
+			Method:  "GET",
+			Pattern: "/goapp/sessions/{id}",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerSession)),
+		},
+		{
+			Name:    "session-close",
+			Method:  "DELETE",
+			Pattern: "/goapp/sessions/{id}",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerSessionClose)),
+		},
+		{
+			Name:    "session-message",
+			Method:  "POST",
+			Pattern: "/goapp/sessions/{id}/messages",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerSessionMessage)),
+		},
+		{
+			Name:    "session-history",
+			Method:  "GET",
+			Pattern: "/goapp/history/sessions",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerSessionHistory)),
+		},
+		{
+			Name:    "session-rollups",
+			Method:  "GET",
+			Pattern: "/goapp/history/hourly",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerSessionRollups)),
+		},
+		{
+			Name:    "dashboard",
+			Method:  "GET",
+			Pattern: "/goapp/admin",
+			HFunc:   s.handlerWrapper(s.adminOnly(s.handlerDashboard)),
+		},
+		{
+			Name:    "dashboard-feed",
+			Method:  "GET",
+			Pattern: "/goapp/admin/feed",
+			HFunc:   s.handlerWrapper(s.adminOrDashboard(s.handlerDashboardFeed)),
+		},
 		{
 			Name:    "websocket",
 			Method:  "GET",
 			Pattern: "/goapp/ws",
 			HFunc:   s.handlerWrapper(s.handlerWebSocket),
 		},
+		{
+			Name:    "sse",
+			Method:  "GET",
+			Pattern: "/goapp/sse",
+			HFunc:   s.handlerWrapper(s.handlerSSE),
+		},
+		{
+			Name:    "csrf",
+			Method:  "GET",
+			Pattern: "/goapp/csrf",
+			HFunc:   s.handlerWrapper(s.handlerCSRF),
+		},
+		{
+			Name:    "poll-create",
+			Method:  "POST",
+			Pattern: "/goapp/poll",
+			HFunc:   s.handlerWrapper(s.handlerPollCreate),
+		},
+		{
+			Name:    "poll",
+			Method:  "GET",
+			Pattern: "/goapp/poll/{id}",
+			HFunc:   s.handlerWrapper(s.handlerPoll),
+		},
+		{
+			Name:    "poll-reset",
+			Method:  "POST",
+			Pattern: "/goapp/poll/{id}/reset",
+			HFunc:   s.handlerWrapper(s.handlerPollReset),
+		},
+		{
+			Name:    "poll-delete",
+			Method:  "DELETE",
+			Pattern: "/goapp/poll/{id}",
+			HFunc:   s.handlerWrapper(s.handlerPollDelete),
+		},
+		{
+			Name:    "graphql",
+			Method:  "GET",
+			Pattern: "/goapp/graphql",
+			HFunc:   s.handlerWrapper(s.handlerGraphQL),
+		},
+		{
+			Name:    "graphql-post",
+			Method:  "POST",
+			Pattern: "/goapp/graphql",
+			HFunc:   s.handlerWrapper(s.handlerGraphQL),
+		},
 		{
 			Name:    "home",
 			Method:  "GET",
@@ -37,6 +145,44 @@ func (s *Server) myRoutes() []Route {
 	}
 }
 
+// debugRoutes are the runtime debug endpoints, auth wraps their handlers:
+// the admin listener serves them as they are and the HTTP listener behind
+// the admin credentials.
+func (s *Server) debugRoutes(auth func(func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request)) []Route {
+	return []Route{
+		{
+			Name:    "debug-pprof",
+			Method:  "GET",
+			Pattern: "/goapp/debug/pprof/",
+			HFunc:   s.handlerWrapper(auth(s.handlerDebugPprof)),
+		},
+		{
+			Name:    "debug-pprof-profile",
+			Method:  "GET",
+			Pattern: "/goapp/debug/pprof/{profile}",
+			HFunc:   s.handlerWrapper(auth(s.handlerDebugPprof)),
+		},
+		{
+			Name:    "debug-goroutines",
+			Method:  "GET",
+			Pattern: "/goapp/debug/goroutines",
+			HFunc:   s.handlerWrapper(auth(s.handlerDebugGoroutines)),
+		},
+		{
+			Name:    "debug-heap",
+			Method:  "GET",
+			Pattern: "/goapp/debug/heap",
+			HFunc:   s.handlerWrapper(auth(s.handlerDebugHeap)),
+		},
+		{
+			Name:    "debug-counts",
+			Method:  "GET",
+			Pattern: "/goapp/debug/counts",
+			HFunc:   s.handlerWrapper(auth(s.handlerDebugCounts)),
+		},
+	}
+}
+
 func (s *Server) handlerWrapper(handlerFunc func(http.ResponseWriter, *http.Request)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
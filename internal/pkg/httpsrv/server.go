@@ -1,35 +1,98 @@
 package httpsrv
 
 import (
+	"compress/flate"
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
-	"github.com/gorilla/handlers"
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/logging"
+	"goapp/internal/pkg/metrics"
+	"goapp/internal/pkg/sessiondb"
+	"goapp/internal/pkg/summary"
+
 	"github.com/gorilla/mux"
 	"github.com/gorilla/securecookie"
+	"github.com/graphql-go/graphql"
 )
 
+type Config struct {
+	Addr              string         // HTTP listen address.
+	ReadBufferSize    int            // WebSocket read buffer size.
+	WriteBufferSize   int            // WebSocket write buffer size.
+	Compression       bool           // Negotiate permessage-deflate with WebSocket clients.
+	CompressionLevel  int            // Deflate level, from -2 (Huffman only) to 9 (best compression).
+	CompressionMin    int            // Messages smaller than this many bytes are sent uncompressed.
+	HistorySize       int            // Number of recent values kept for stream resumption.
+	MaxPollSessions   int            // Long-polling sessions open at once, 0 for no limit.
+	PollIdleTimeout   time.Duration  // Long-polling session is closed when not polled for this long.
+	DrainTimeout      time.Duration  // Wait for WebSocket clients to close on shutdown.
+	HeartbeatInterval time.Duration  // WebSocket heartbeat interval, 0 disables heartbeats.
+	Engine            string         // WebSocket engine, EngineGoroutine or EngineEpoll.
+	EngineWorkers     int            // Workers of the epoll engine, 0 runs one per CPU.
+	AdminUser         string         // User of the admin endpoints.
+	AdminPassword     string         // Password of the admin endpoints, empty disables them.
+	Summary           summary.Config // Where the summaries of ended sessions go.
+	SessionDB         string         // Database file keeping the summaries of ended sessions, empty disables it.
+	SessionRetention  time.Duration  // Age of the sessions pruned from the database, 0 keeps them.
+	AdminAddr         string         // Listen address serving the debug endpoints without credentials, empty disables it.
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:              "localhost:8080",
+		ReadBufferSize:    4096,
+		WriteBufferSize:   4096,
+		CompressionLevel:  flate.BestSpeed,
+		CompressionMin:    128,
+		HistorySize:       1000,
+		MaxPollSessions:   1000,
+		PollIdleTimeout:   60 * time.Second,
+		DrainTimeout:      10 * time.Second,
+		HeartbeatInterval: 15 * time.Second,
+		Engine:            EngineGoroutine,
+		AdminUser:         "admin",
+		Summary:           summary.Config{Log: true},
+		SessionRetention:  30 * 24 * time.Hour,
+	}
+}
+
 type Server struct {
-	strChan      <-chan string
-	server       *http.Server
-	watchers     map[string]*watcher.Watcher
-	watchersLock *sync.RWMutex
-	stats        *statsManager
-	secureCookie *securecookie.SecureCookie
-	ctx          context.Context
-	cancel       context.CancelFunc
-	running      sync.WaitGroup
+	cfg            Config
+	broker         broker.Broker
+	server         *http.Server
+	adminServer    *http.Server // Serves the debug endpoints, nil without an admin listener.
+	sessions       map[string]*session
+	sessionsLock   *sync.RWMutex
+	polls          map[string]*pollSession
+	pollsLock      *sync.RWMutex
+	stats          *statsManager
+	summaries      *summary.Recorder // Summaries of the ended sessions.
+	sessionDB      *sessiondb.Store  // Stored summaries, nil when disabled.
+	history        *history
+	graphqlSchema  graphql.Schema
+	epoll          *epollEngine // Serves the WebSocket sessions, nil with the goroutine engine.
+	secureCookie   *securecookie.SecureCookie
+	drainLock      sync.Mutex
+	draining       bool           // No new sessions are accepted.
+	drainChannel   chan struct{}  // Closed when draining starts.
+	webSockets     sync.WaitGroup // Live WebSocket connections.
+	webSocketCount int            // Number of live WebSocket connections.
+	ctx            context.Context
+	cancel         context.CancelFunc
+	running        sync.WaitGroup
 }
 
-func New(strChan <-chan string) *Server {
+func New(cfg Config, b broker.Broker) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
 	hashKey := make([]byte, 32)
 	blockKey := make([]byte, 32)
 	if _, err := rand.Read(hashKey); err != nil {
@@ -40,37 +103,64 @@ func New(strChan <-chan string) *Server {
 	}
 
 	s := &Server{
-		strChan:      strChan,
-		watchers:     make(map[string]*watcher.Watcher),
-		watchersLock: &sync.RWMutex{},
+		cfg:          cfg,
+		broker:       b,
+		sessions:     make(map[string]*session),
+		sessionsLock: &sync.RWMutex{},
+		polls:        make(map[string]*pollSession),
+		pollsLock:    &sync.RWMutex{},
+		history:      newHistory(cfg.HistorySize),
+		summaries:    summary.New(cfg.Summary),
+		drainChannel: make(chan struct{}),
 		secureCookie: securecookie.New(hashKey, blockKey),
 		ctx:          ctx,
 		cancel:       cancel,
 	}
-	
+
+	if cfg.SessionDB != "" {
+		s.sessionDB = sessiondb.New(sessiondb.Config{Path: cfg.SessionDB, Retention: cfg.SessionRetention})
+		s.summaries.AddSink(s.sessionDB)
+	}
+
 	s.initStats()
 	return s
 }
 
 func (s *Server) Start() error {
-	r := mux.NewRouter()
-	
-	r.Use(s.csrfMiddleware)
-	r.Use(s.securityHeadersMiddleware)
+	if s.cfg.CompressionLevel < flate.HuffmanOnly || s.cfg.CompressionLevel > flate.BestCompression {
+		return fmt.Errorf("invalid compression level %d", s.cfg.CompressionLevel)
+	}
+	if s.cfg.PollIdleTimeout <= 0 {
+		return fmt.Errorf("invalid poll idle timeout %s", s.cfg.PollIdleTimeout)
+	}
 
-	for _, route := range s.myRoutes() {
-		r.Handle(route.Pattern, route.HFunc).
-			Methods(route.Method).
-			Name(route.Name)
-		
-		if route.Queries != nil {
-			r.Queries(route.Queries...)
+	schema, err := s.newGraphQLSchema()
+	if err != nil {
+		return fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
+	s.graphqlSchema = schema
+
+	if s.sessionDB != nil {
+		if err := s.sessionDB.Start(); err != nil {
+			return err
 		}
 	}
 
+	if err := s.summaries.Start(); err != nil {
+		s.stopSessionDB()
+		return err
+	}
+
+	if err := s.startEngine(); err != nil {
+		s.summaries.Stop()
+		s.stopSessionDB()
+		return err
+	}
+
 	s.server = &http.Server{
-		Addr:              "localhost:8080",
-		Handler:           handlers.CombinedLoggingHandler(os.Stdout, r),
+		Addr:              s.cfg.Addr,
+		Handler:           s.newHandler(append(s.myRoutes(), s.debugRoutes(s.adminOnly)...)),
+		ErrorLog:          logging.StdLogger(slog.LevelWarn),
 		ReadTimeout:       15 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		WriteTimeout:      15 * time.Second,
@@ -82,27 +172,86 @@ func (s *Server) Start() error {
 	go func() {
 		defer s.running.Done()
 		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v\n", err)
+			slog.Error("HTTP server error", logging.Err(err))
 		}
 	}()
 
+	if s.cfg.AdminAddr != "" {
+		// Without a write timeout, CPU profiles and traces last as long
+		// as asked.
+		s.adminServer = &http.Server{
+			Addr:              s.cfg.AdminAddr,
+			Handler:           s.newHandler(s.debugRoutes(unauthenticated)),
+			ErrorLog:          logging.StdLogger(slog.LevelWarn),
+			ReadHeaderTimeout: 5 * time.Second,
+			IdleTimeout:       30 * time.Second,
+		}
+
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			if err := s.adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("admin listener error", logging.Err(err))
+			}
+		}()
+	}
+
 	s.running.Add(1)
 	go s.mainLoop()
 
 	return nil
 }
 
+// Stop drains the WebSocket sessions and stops the server.
 func (s *Server) Stop() {
+	s.drain()
 	s.cancel()
+	// Sessions left at the drain deadline end with the server context.
+	s.webSockets.Wait()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := s.server.Shutdown(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v\n", err)
+		slog.Error("HTTP server shutdown error", logging.Err(err))
+	}
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			slog.Error("admin listener shutdown error", logging.Err(err))
+		}
 	}
 
 	s.running.Wait()
+	s.summaries.Stop()
+	s.stopSessionDB()
+}
+
+func (s *Server) stopSessionDB() {
+	if s.sessionDB != nil {
+		s.sessionDB.Stop()
+	}
+}
+
+// newHandler routes the requests to routes, with request IDs, access logs
+// and spans.
+func (s *Server) newHandler(routes []Route) http.Handler {
+	r := mux.NewRouter()
+
+	r.Use(spanRouteMiddleware)
+	r.Use(s.csrfMiddleware)
+	r.Use(s.securityHeadersMiddleware)
+
+	for _, route := range routes {
+		r.Handle(route.Pattern, route.HFunc).
+			Methods(route.Method).
+			Name(route.Name)
+
+		if route.Queries != nil {
+			r.Queries(route.Queries...)
+		}
+	}
+
+	return requestIDMiddleware(accessLogMiddleware(tracingMiddleware(r)))
 }
 
 func (s *Server) mainLoop() {
@@ -110,8 +259,12 @@ func (s *Server) mainLoop() {
 
 	for {
 		select {
-		case str := <-s.strChan:
-			s.notifyWatchers(str)
+		case m := <-s.broker.Messages():
+			s.history.add(m)
+			s.addValueStats()
+			span := s.startDispatchSpan(m)
+			n := s.notifySessions(m)
+			endDispatchSpan(span, n)
 		case <-s.ctx.Done():
 			return
 		}
@@ -125,6 +278,7 @@ func (s *Server) csrfMiddleware(next http.Handler) http.Handler {
 
 			origin := r.Header.Get("Origin")
 			if !s.isValidOrigin(origin) {
+				metrics.HandshakeFailures.WithLabelValues(metrics.ReasonOrigin).Inc()
 				http.Error(w, "Invalid origin", http.StatusForbidden)
 				return
 			}
@@ -132,14 +286,9 @@ func (s *Server) csrfMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if r.Method != "GET" {
-			token := r.Header.Get("X-CSRF-Token")
-			cookie, err := r.Cookie("csrf_token")
-			
-			if err != nil || token == "" || token != cookie.Value {
-				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
-				return
-			}
+		if r.Method != "GET" && !s.isValidCSRFToken(r) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
 		}
 
 		next.ServeHTTP(w, r)
@@ -158,12 +307,30 @@ func (s *Server) securityHeadersMiddleware(next http.Handler) http.Handler {
 
 func (s *Server) isValidOrigin(origin string) bool {
 	allowedOrigins := map[string]bool{
-		"http://localhost:8080": true,
+		"http://localhost:8080":  true,
 		"https://localhost:8080": true,
+		"http://" + s.cfg.Addr:   true,
+		"https://" + s.cfg.Addr:  true,
 	}
 	return allowedOrigins[origin]
 }
 
+// isValidCSRFToken checks the X-CSRF-Token header against the token sealed in
+// the csrf_token cookie.
+func (s *Server) isValidCSRFToken(r *http.Request) bool {
+	token := r.Header.Get("X-CSRF-Token")
+	cookie, err := r.Cookie("csrf_token")
+	if err != nil || token == "" {
+		return false
+	}
+
+	var expected string
+	if err := s.secureCookie.Decode("csrf_token", cookie.Value, &expected); err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
 func (s *Server) generateCSRFToken() string {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -194,4 +361,4 @@ func (s *Server) setCSRFToken(w http.ResponseWriter) string {
 	})
 
 	return token
-}
\ No newline at end of file
+}
@@ -0,0 +1,74 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goapp/internal/pkg/broker"
+)
+
+// testPassword is the admin password of the servers of newAdminClient.
+const testPassword = "secret"
+
+// testClient sends requests through the routes and middlewares of a server,
+// as its listener does.
+type testClient struct {
+	t        *testing.T
+	s        *Server
+	handler  http.Handler
+	password string // Admin password sent with the requests, none when empty.
+}
+
+func newTestClient(t *testing.T, cfg Config) *testClient {
+	s := New(cfg, broker.NewLocal())
+	t.Cleanup(func() {
+		s.cancel()
+		s.running.Wait()
+	})
+	return &testClient{t: t, s: s, handler: s.newHandler(append(s.myRoutes(), s.debugRoutes(s.adminOnly)...))}
+}
+
+// newAdminClient returns a client sending the admin credentials to a server
+// with cfg and the admin password testPassword.
+func newAdminClient(t *testing.T, cfg Config) *testClient {
+	cfg.AdminPassword = testPassword
+	c := newTestClient(t, cfg)
+	c.password = testPassword
+	return c
+}
+
+// withPassword returns a client sending password as the admin password, none
+// when empty.
+func (c *testClient) withPassword(password string) *testClient {
+	cc := *c
+	cc.password = password
+	return &cc
+}
+
+// do sends a request, with a valid CSRF token when csrf is true.
+func (c *testClient) do(method, url string, csrf bool) *httptest.ResponseRecorder {
+	return c.doBody(method, url, "", csrf)
+}
+
+// doBody sends a request with body, with a valid CSRF token when csrf is
+// true.
+func (c *testClient) doBody(method, url, body string, csrf bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if c.password != "" {
+		req.SetBasicAuth(c.s.cfg.AdminUser, c.password)
+	}
+	if csrf {
+		token := "token"
+		cookie, err := c.s.secureCookie.Encode("csrf_token", token)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: cookie})
+		req.Header.Set("X-CSRF-Token", token)
+	}
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,190 @@
+package httpsrv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"goapp/internal/pkg/codec"
+	"goapp/internal/pkg/logging"
+	"goapp/internal/pkg/watcher"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transports a session can be served over.
+const (
+	transportWebSocket = "websocket"
+	transportSSE       = "sse"
+	transportPoll      = "poll"
+	transportGraphQL   = "graphql"
+)
+
+// Profiler labels of the session goroutines.
+const (
+	labelSession   = "session"
+	labelTransport = "transport"
+)
+
+// topicValues is the topic of the generated value stream. Sessions are
+// subscribed to it when they start.
+const topicValues = "values"
+
+// session is a client receiving the value stream over one of the
+// transports. Every session has its own watcher counting the values.
+type session struct {
+	transport  string                        // Transport serving the session.
+	remoteAddr string                        // Client address.
+	log        *slog.Logger                  // Logger of the session lines.
+	userAgent  string                        // User-Agent of the client, if any.
+	origin     string                        // Origin of the client, if any.
+	requestID  string                        // ID of the request starting the session, if any.
+	protocol   string                        // Negotiated WebSocket subprotocol.
+	started    time.Time                     // Session start.
+	watch      *watcher.Watcher              // Counter of the session.
+	codec      codec.Codec                   // Message encoding negotiated by the client.
+	wire       *countingConn                 // Connection counting bytes on the wire, WebSocket only.
+	paused     atomic.Bool                   // Value delivery paused by the client.
+	filter     atomic.Pointer[regexp.Regexp] // Values to deliver, nil delivers all.
+	topics     map[string]bool               // Subscribed topics.
+	topicsLock sync.RWMutex                  // Lock for topics.
+	heartbeat  heartbeat                     // Heartbeats waiting for the client echo.
+	deliver    func(watcher.Counter)         // Delivers values without a watcher goroutine, epoll engine only.
+	control    atomic.Value                  // sessionControl of the transport, unset when not supported.
+	parent     trace.SpanContext             // Span of the request starting the session, if any.
+	span       trace.Span                    // Span of the session lifetime.
+}
+
+// startSession creates a session with a running watcher for the client at
+// remoteAddr. The session receives values once added to the hub with addSession() or
+// resumeSession(), removeSession() must be called at the end.
+func startSession(transport, remoteAddr string) (*session, error) {
+	sess := newSession(transport, remoteAddr)
+	var err error
+	pprof.Do(context.Background(), sess.labels(), func(context.Context) {
+		err = sess.watch.Start()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start watcher: %w", err)
+	}
+	return sess, nil
+}
+
+// newSession creates a session whose watcher is not started, values are
+// counted with Next() and handed to deliver.
+func newSession(transport, remoteAddr string) *session {
+	sess := &session{
+		transport:  transport,
+		remoteAddr: remoteAddr,
+		started:    time.Now(),
+		watch:      watcher.New(),
+		codec:      codec.JSON,
+		topics:     map[string]bool{topicValues: true},
+	}
+	sess.log = slog.Default().With(logging.KeySession, sess.id(), logging.KeyTransport, transport)
+	return sess
+}
+
+func (ss *session) id() string { return ss.watch.GetWatcherId() }
+
+// labels are the profiler labels of the goroutines serving the session, the
+// debug goroutine dump groups the goroutines by them.
+func (ss *session) labels() pprof.LabelSet {
+	return pprof.Labels(labelSession, ss.id(), labelTransport, ss.transport)
+}
+
+// labelGoroutine labels the calling goroutine, and the goroutines it starts,
+// with the session until the returned func restores the labels of ctx.
+func (ss *session) labelGoroutine(ctx context.Context) func() {
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, ss.labels()))
+	return func() { pprof.SetGoroutineLabels(ctx) }
+}
+
+// setClient records the client information of the request starting the
+// session, before the session is added to the hub.
+func (ss *session) setClient(r *http.Request) {
+	ss.userAgent = r.UserAgent()
+	ss.origin = r.Header.Get("Origin")
+	ss.parent = trace.SpanContextFromContext(r.Context())
+	if ss.requestID = logging.RequestID(r.Context()); ss.requestID != "" {
+		ss.log = ss.log.With(logging.KeyRequestID, ss.requestID)
+	}
+}
+
+// send hands a value to the session watcher, or counts and delivers it
+// directly when the session has no watcher goroutine.
+func (ss *session) send(seq uint64, value string) {
+	if ss.deliver == nil {
+		ss.watch.Send(seq, value)
+		return
+	}
+	ss.deliver(ss.watch.Next(seq, value))
+}
+
+// reset sets the session counter to zero and delivers it.
+func (ss *session) reset() {
+	if ss.deliver == nil {
+		ss.watch.ResetCounter()
+		return
+	}
+	ss.deliver(ss.watch.Reset())
+}
+
+// controller returns the admin control of the session, nil when the
+// transport has none.
+func (ss *session) controller() sessionControl {
+	c, _ := ss.control.Load().(sessionControl)
+	return c
+}
+
+// subscribe adds a topic of the session, false when it already has
+// maxTopics others.
+func (ss *session) subscribe(topic string) bool {
+	ss.topicsLock.Lock()
+	defer ss.topicsLock.Unlock()
+	if !ss.topics[topic] && len(ss.topics) >= maxTopics {
+		return false
+	}
+	ss.topics[topic] = true
+	return true
+}
+
+func (ss *session) unsubscribe(topic string) {
+	ss.topicsLock.Lock()
+	defer ss.topicsLock.Unlock()
+	delete(ss.topics, topic)
+}
+
+func (ss *session) subscribed(topic string) bool {
+	ss.topicsLock.RLock()
+	defer ss.topicsLock.RUnlock()
+	return ss.topics[topic]
+}
+
+func (ss *session) topicList() []string {
+	ss.topicsLock.RLock()
+	defer ss.topicsLock.RUnlock()
+
+	topics := make([]string, 0, len(ss.topics))
+	for topic := range ss.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// wantsValue reports whether a generated value should be delivered.
+func (ss *session) wantsValue(value string) bool {
+	if ss.paused.Load() || !ss.subscribed(topicValues) {
+		return false
+	}
+	filter := ss.filter.Load()
+	return filter == nil || filter.MatchString(value)
+}
@@ -1,17 +1,33 @@
 package httpsrv
 
 import (
-	"log"
 	"sync"
+	"time"
+
+	"goapp/internal/pkg/metrics"
+	"goapp/internal/pkg/summary"
 )
 
 type sessionStats struct {
-	id   string
-	sent int64
+	id          string
+	transport   string
+	sent        int64
+	rawBytes    int64    // Message bytes before compression.
+	wireBytes   int64    // Frame bytes written to the connection.
+	received    int64    // Message bytes received from the client.
+	resets      int64    // Counter resets.
+	dropped     int64    // Values dropped from a full outbound queue.
+	maxQueue    int      // Highest outbound queue depth.
+	closeCode   int      // WebSocket close code, 0 when none applies.
+	closeReason string   // Why the session ended.
+	closed      bool     // The close code and reason are set.
+	rtt         rttStats // Heartbeat round trips.
 }
 
 type statsManager struct {
 	sessions map[string]*sessionStats
+	values   int64 // Values received by the hub.
+	dropped  int64 // Values dropped by all sessions, ended ones included.
 	mu       sync.RWMutex
 }
 
@@ -21,41 +37,162 @@ func newStatsManager() *statsManager {
 	}
 }
 
-func (sm *statsManager) increment(id string) {
+// open starts the stats of a session served over transport.
+func (sm *statsManager) open(id, transport string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.sessions[id] = &sessionStats{id: id, transport: transport}
+	metrics.SessionsActive.WithLabelValues(transport).Inc()
+	metrics.SessionsTotal.WithLabelValues(transport).Inc()
+}
+
+// update calls f with the stats of session id, unless the session ended.
+func (sm *statsManager) update(id string, f func(stats *sessionStats)) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	
+
 	if stats, exists := sm.sessions[id]; exists {
+		f(stats)
+	}
+}
+
+func (sm *statsManager) increment(id string) {
+	sm.update(id, func(stats *sessionStats) {
 		stats.sent++
-	} else {
-		sm.sessions[id] = &sessionStats{
-			id:   id,
-			sent: 1,
+		metrics.MessagesSent.WithLabelValues(stats.transport).Inc()
+	})
+}
+
+func (sm *statsManager) addBytes(id string, raw, wire int64) {
+	sm.update(id, func(stats *sessionStats) {
+		stats.rawBytes += raw
+		stats.wireBytes += wire
+		metrics.MessageBytes.WithLabelValues(stats.transport).Add(float64(raw))
+		metrics.BytesSent.WithLabelValues(stats.transport).Add(float64(wire))
+	})
+}
+
+func (sm *statsManager) addReset(id string) {
+	sm.update(id, func(stats *sessionStats) {
+		stats.resets++
+		metrics.Resets.WithLabelValues(stats.transport).Inc()
+	})
+}
+
+func (sm *statsManager) addDrop(id string) {
+	sm.update(id, func(stats *sessionStats) {
+		stats.dropped++
+		sm.dropped++
+		metrics.Drops.WithLabelValues(stats.transport).Inc()
+	})
+}
+
+func (sm *statsManager) addValue() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.values++
+}
+
+// totals returns the values received by the hub and dropped by the sessions
+// since the start.
+func (sm *statsManager) totals() (values, dropped int64) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.values, sm.dropped
+}
+
+func (sm *statsManager) addReceived(id string, n int64) {
+	sm.update(id, func(stats *sessionStats) {
+		stats.received += n
+	})
+}
+
+func (sm *statsManager) observeQueue(id string, depth int) {
+	sm.update(id, func(stats *sessionStats) {
+		if depth > stats.maxQueue {
+			stats.maxQueue = depth
 		}
-	}
+	})
+}
+
+// setClose records why the session ended, the first cause is kept.
+func (sm *statsManager) setClose(id string, code int, reason string) {
+	sm.update(id, func(stats *sessionStats) {
+		if !stats.closed {
+			stats.closeCode, stats.closeReason, stats.closed = code, reason, true
+		}
+	})
+}
+
+func (sm *statsManager) addRTT(id string, rtt time.Duration) {
+	sm.update(id, func(stats *sessionStats) {
+		stats.rtt.add(rtt)
+	})
+	metrics.ObserveHeartbeatRTT(rtt.Seconds())
 }
 
 func (sm *statsManager) getStats(id string) *sessionStats {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	
+
 	if stats, exists := sm.sessions[id]; exists {
-		return &sessionStats{
-			id:   stats.id,
-			sent: stats.sent,
-		}
+		copied := *stats
+		copied.rtt.recent = append([]time.Duration(nil), stats.rtt.recent...)
+		return &copied
 	}
 	return nil
 }
 
-func (sm *statsManager) removeStats(id string) {
+// removeStats ends the stats of a session and returns them, nil when the
+// session ended already.
+func (sm *statsManager) removeStats(id string) *sessionStats {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	
-	if stats, exists := sm.sessions[id]; exists {
-		log.Printf("session %s has received %d messages\n", stats.id, stats.sent)
-		delete(sm.sessions, id)
+
+	stats, exists := sm.sessions[id]
+	if !exists {
+		return nil
+	}
+	delete(sm.sessions, id)
+	metrics.SessionsActive.WithLabelValues(stats.transport).Dec()
+	return stats
+}
+
+// summarize returns the summary record of an ended session.
+func summarize(sess *session, stats *sessionStats) summary.Record {
+	ended := time.Now()
+	r := summary.Record{
+		ID:            sess.id(),
+		Transport:     sess.transport,
+		RequestID:     sess.requestID,
+		RemoteAddr:    sess.remoteAddr,
+		UserAgent:     sess.userAgent,
+		Origin:        sess.origin,
+		Protocol:      sess.protocol,
+		Started:       sess.started,
+		Ended:         ended,
+		DurationMs:    milliseconds(ended.Sub(sess.started)),
+		Sent:          stats.sent,
+		RawBytes:      stats.rawBytes,
+		WireBytes:     stats.wireBytes,
+		ReceivedBytes: stats.received,
+		Resets:        stats.resets,
+		Dropped:       stats.dropped,
+		MaxQueueDepth: stats.maxQueue,
+		CloseCode:     stats.closeCode,
+		CloseReason:   stats.closeReason,
 	}
+	if stats.rtt.count > 0 {
+		min, avg, p99 := stats.rtt.summary()
+		r.RTT = &summary.RTT{
+			Samples: stats.rtt.count,
+			MinMs:   milliseconds(min),
+			AvgMs:   milliseconds(avg),
+			P99Ms:   milliseconds(p99),
+		}
+	}
+	return r
 }
 
 func (s *Server) initStats() {
@@ -66,6 +203,38 @@ func (s *Server) incStats(id string) {
 	s.stats.increment(id)
 }
 
-func (s *Server) removeStats(id string) {
-	s.stats.removeStats(id)
-}
\ No newline at end of file
+func (s *Server) addBytesStats(id string, raw, wire int64) {
+	s.stats.addBytes(id, raw, wire)
+}
+
+func (s *Server) addResetStats(id string) {
+	s.stats.addReset(id)
+}
+
+func (s *Server) addDropStats(id string) {
+	s.stats.addDrop(id)
+}
+
+func (s *Server) addValueStats() {
+	s.stats.addValue()
+}
+
+func (s *Server) addReceivedStats(id string, n int64) {
+	s.stats.addReceived(id, n)
+}
+
+func (s *Server) observeQueueStats(id string, depth int) {
+	s.stats.observeQueue(id, depth)
+}
+
+func (s *Server) setCloseStats(id string, code int, reason string) {
+	s.stats.setClose(id, code, reason)
+}
+
+func (s *Server) addRTTStats(id string, rtt time.Duration) {
+	s.stats.addRTT(id, rtt)
+}
+
+func (s *Server) removeStats(id string) *sessionStats {
+	return s.stats.removeStats(id)
+}
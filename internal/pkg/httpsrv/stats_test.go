@@ -0,0 +1,90 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/metrics"
+	"goapp/internal/pkg/summary"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatsMetrics(t *testing.T) {
+	const transport = "stats-test"
+	s := New(DefaultConfig(), broker.NewLocal())
+
+	sess, err := s.OpenSession(transport, "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Sent(10)
+	sess.Sent(20)
+	sess.Reset()
+
+	if v := testutil.ToFloat64(metrics.SessionsActive.WithLabelValues(transport)); v != 1 {
+		t.Fatalf("got %v active sessions, want 1", v)
+	}
+	if v := testutil.ToFloat64(metrics.MessagesSent.WithLabelValues(transport)); v != 2 {
+		t.Fatalf("got %v messages, want 2", v)
+	}
+	if v := testutil.ToFloat64(metrics.BytesSent.WithLabelValues(transport)); v != 30 {
+		t.Fatalf("got %v bytes, want 30", v)
+	}
+	if v := testutil.ToFloat64(metrics.Resets.WithLabelValues(transport)); v != 1 {
+		t.Fatalf("got %v resets, want 1", v)
+	}
+
+	sess.Close()
+	// Counted no more once the session ended.
+	sess.Sent(10)
+
+	if v := testutil.ToFloat64(metrics.SessionsActive.WithLabelValues(transport)); v != 0 {
+		t.Fatalf("got %v active sessions, want 0", v)
+	}
+	if v := testutil.ToFloat64(metrics.MessagesSent.WithLabelValues(transport)); v != 2 {
+		t.Fatalf("got %v messages after close, want 2", v)
+	}
+}
+
+func TestSessionSummary(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "summaries.jsonl")
+	cfg := DefaultConfig()
+	cfg.Summary = summary.Config{File: file}
+	s := New(cfg, broker.NewLocal())
+	if err := s.summaries.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := s.OpenSession("tcp", "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.SetUserAgent("nc")
+	sess.Sent(10)
+	sess.Received(6)
+	s.observeQueueStats(sess.ID(), 3)
+	s.observeQueueStats(sess.ID(), 2)
+	sess.SetCloseReason("client disconnected")
+	sess.SetCloseReason("server stopped")
+	sess.Close()
+	s.summaries.Stop()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r summary.Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != sess.ID() || r.Transport != "tcp" || r.UserAgent != "nc" || r.Sent != 1 || r.WireBytes != 10 || r.ReceivedBytes != 6 {
+		t.Fatalf("got %+v, want the counters of the session", r)
+	}
+	if r.MaxQueueDepth != 3 || r.CloseReason != "client disconnected" || r.Ended.Before(r.Started) {
+		t.Fatalf("got %+v, want max queue depth 3 and the first close reason", r)
+	}
+}
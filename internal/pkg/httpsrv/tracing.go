@@ -0,0 +1,152 @@
+package httpsrv
+
+import (
+	"context"
+	"net/http"
+
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/logging"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("goapp/internal/pkg/httpsrv")
+
+// Span attribute keys of the application.
+const (
+	attrRequestID   = attribute.Key("goapp.request_id")
+	attrSession     = attribute.Key("goapp.session.id")
+	attrTransport   = attribute.Key("goapp.transport")
+	attrEngine      = attribute.Key("goapp.websocket.engine")
+	attrProtocol    = attribute.Key("goapp.websocket.protocol")
+	attrSeq         = attribute.Key("goapp.value.seq")
+	attrSessions    = attribute.Key("goapp.sessions")
+	attrSent        = attribute.Key("goapp.session.sent")
+	attrWireBytes   = attribute.Key("goapp.session.wire_bytes")
+	attrDropped     = attribute.Key("goapp.session.dropped")
+	attrCloseCode   = attribute.Key("goapp.session.close_code")
+	attrCloseReason = attribute.Key("goapp.session.close_reason")
+)
+
+// tracingMiddleware starts a server span for every request, child of the
+// trace context of the request headers. It runs inside the access log, whose
+// recorder gives the response status.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(r.RemoteAddr),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				attrRequestID.String(logging.RequestID(r.Context())),
+			))
+		defer span.End()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		rec, ok := w.(*accessRecorder)
+		if !ok {
+			return
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if rec.err != nil {
+			span.RecordError(rec.err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// spanRouteMiddleware names the request span after the matched route.
+func spanRouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + tmpl)
+				span.SetAttributes(semconv.HTTPRoute(tmpl))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startUpgradeSpan starts the span of a WebSocket handshake served by engine,
+// ended with endUpgradeSpan.
+func startUpgradeSpan(ctx context.Context, engine string) trace.Span {
+	_, span := tracer.Start(ctx, "websocket.upgrade", trace.WithAttributes(attrEngine.String(engine)))
+	return span
+}
+
+func endUpgradeSpan(span trace.Span, protocol string, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "upgrade failed")
+	} else {
+		span.SetAttributes(attrProtocol.String(protocol))
+	}
+	span.End()
+}
+
+// startSpan starts the span of the session lifetime, child of the request
+// starting the session, ended with endSpan.
+func (ss *session) startSpan() {
+	ctx := trace.ContextWithSpanContext(context.Background(), ss.parent)
+	_, ss.span = tracer.Start(ctx, "session", trace.WithAttributes(
+		attrSession.String(ss.id()),
+		attrTransport.String(ss.transport),
+		semconv.ClientAddress(ss.remoteAddr),
+		semconv.UserAgentOriginal(ss.userAgent),
+		attrRequestID.String(ss.requestID),
+	))
+}
+
+func (ss *session) endSpan(stats *sessionStats) {
+	if ss.span == nil {
+		return
+	}
+	if stats != nil {
+		ss.span.SetAttributes(
+			attrSent.Int64(stats.sent),
+			attrWireBytes.Int64(stats.wireBytes),
+			attrDropped.Int64(stats.dropped),
+			attrCloseCode.Int(stats.closeCode),
+			attrCloseReason.String(stats.closeReason),
+		)
+	}
+	ss.span.End()
+}
+
+// startDispatchSpan starts the span of the dispatch of a value, at the time
+// the value was generated, so its duration is the latency from the generator
+// to the hand-off to the sessions. The writes to the clients happen later,
+// from every session queue, and are not part of it.
+func (s *Server) startDispatchSpan(m broker.Message) trace.Span {
+	var opts []trace.SpanStartOption
+	if !m.Time.IsZero() {
+		opts = append(opts, trace.WithTimestamp(m.Time))
+	}
+	opts = append(opts, trace.WithAttributes(attrSeq.Int64(int64(m.Seq))))
+	_, span := tracer.Start(s.ctx, "value.dispatch", opts...)
+	return span
+}
+
+// endDispatchSpan ends the span of the dispatch of a value to n sessions.
+func endDispatchSpan(span trace.Span, n int) {
+	span.SetAttributes(attrSessions.Int(n))
+	span.End()
+}
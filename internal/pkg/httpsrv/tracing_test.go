@@ -0,0 +1,57 @@
+package httpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goapp/internal/pkg/broker"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestTracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	s := New(DefaultConfig(), broker.NewLocal())
+	h := requestIDMiddleware(accessLogMiddleware(tracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := startSession(transportSSE, r.RemoteAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.setClient(r)
+		s.addSession(sess)
+		s.removeSession(sess)
+		w.WriteHeader(http.StatusTeapot)
+	}))))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest(http.MethodGet, "/goapp/sse", nil)
+	r.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("got %d spans, want the session and the request", len(ended))
+	}
+	session, request := ended[0], ended[1]
+	if request.SpanContext().TraceID().String() != traceID || request.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("got request span %v parent %v, want the incoming trace context", request.SpanContext(), request.Parent())
+	}
+	if session.Name() != "session" || session.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Fatalf("got span %q parent %v, want the session span child of the request", session.Name(), session.Parent())
+	}
+	var status bool
+	for _, a := range request.Attributes() {
+		status = status || a == semconv.HTTPResponseStatusCode(http.StatusTeapot)
+	}
+	if !status {
+		t.Fatalf("got attributes %v, want the response status", request.Attributes())
+	}
+}
@@ -1,106 +1,73 @@
-package watcher
+package httpsrv
 
 import (
-	"context"
-	"sync"
-	"time"
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/watcher"
 
-	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Watcher struct {
-	id          string
-	inCh        chan string
-	outCh       chan *Counter
-	counter     *Counter
-	counterLock *sync.RWMutex
-	ctx         context.Context
-	cancel      context.CancelFunc
-	running     sync.WaitGroup
+func (s *Server) addSession(sess *session) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	s.stats.open(sess.id(), sess.transport)
+	s.sessions[sess.id()] = sess
+	sess.startSpan()
+	sess.log.Debug("session started", "remote_addr", sess.remoteAddr)
 }
 
-func New() *Watcher {
-	ctx, cancel := context.WithCancel(context.Background())
-	w := &Watcher{
-		id:          uuid.NewString(),
-		inCh:        make(chan string, 1),
-		outCh:       make(chan *Counter, 1),
-		counter:     &Counter{Iteration: 0},
-		counterLock: &sync.RWMutex{},
-		ctx:         ctx,
-		cancel:      cancel,
-		running:     sync.WaitGroup{},
-	}
-	return w
-}
-
-func (w *Watcher) Start() error {
-	w.running.Add(1)
-	go w.mainLoop()
-	return nil
+func (s *Server) getSession(id string) *session {
+	s.sessionsLock.RLock()
+	defer s.sessionsLock.RUnlock()
+	return s.sessions[id]
 }
 
-func (w *Watcher) mainLoop() {
-	defer w.running.Done()
-	defer close(w.outCh)
-	defer close(w.inCh)
-
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-w.ctx.Done():
-			return
-		case str := <-w.inCh:
-			if str == "" {
-				continue
-			}
-			w.counterLock.Lock()
-			w.counter.Iteration++
-			w.counterLock.Unlock()
-
-			select {
-			case w.outCh <- w.counter:
-			case <-w.ctx.Done():
-				return
-			case <-ticker.C:
-				continue
-			}
-		}
+// resumeSession adds a session that resumes a stream after lastSeq and returns
+// the kept values it missed, already counted by its watcher. Holding the lock
+// orders the missed values before any value notified later.
+func (s *Server) resumeSession(sess *session, lastSeq uint64) []watcher.Counter {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	s.stats.open(sess.id(), sess.transport)
+	s.sessions[sess.id()] = sess
+	sess.startSpan()
+	sess.span.AddEvent("resumed", trace.WithAttributes(attrSeq.Int64(int64(lastSeq))))
+	sess.log.Debug("session resumed", "remote_addr", sess.remoteAddr, "last_seq", lastSeq)
+
+	var missed []watcher.Counter
+	for _, m := range s.history.since(lastSeq) {
+		missed = append(missed, sess.watch.Next(m.Seq, m.Value))
 	}
+	return missed
 }
 
-func (w *Watcher) Stop() {
-	w.cancel()
-	w.running.Wait()
-}
-
-func (w *Watcher) GetWatcherId() string {
-	return w.id
-}
-
-func (w *Watcher) Send(str string) {
-	select {
-	case w.inCh <- str:
-	case <-w.ctx.Done():
-	default:
+// removeSession removes a session from the hub, stops its watcher and
+// records its summary.
+func (s *Server) removeSession(sess *session) {
+	s.sessionsLock.Lock()
+	stats := s.removeStats(sess.id())
+	delete(s.sessions, sess.id())
+	s.sessionsLock.Unlock()
+
+	sess.watch.Stop()
+	sess.endSpan(stats)
+	if stats != nil {
+		s.summaries.Record(summarize(sess, stats))
 	}
 }
 
-func (w *Watcher) Recv() <-chan *Counter {
-	return w.outCh
+// resetSession resets the counter of a session.
+func (s *Server) resetSession(sess *session) {
+	sess.reset()
+	s.addResetStats(sess.id())
 }
 
-func (w *Watcher) ResetCounter() {
-	w.counterLock.Lock()
-	defer w.counterLock.Unlock()
-
-	w.counter.Iteration = 0
-
-	select {
-	case w.outCh <- w.counter:
-	case <-w.ctx.Done():
-	default:
+// notifySessions hands a value to every session and returns their number.
+func (s *Server) notifySessions(m broker.Message) int {
+	s.sessionsLock.RLock()
+	defer s.sessionsLock.RUnlock()
+	for _, sess := range s.sessions {
+		sess.send(m.Seq, m.Value)
 	}
-}
\ No newline at end of file
+	return len(s.sessions)
+}
@@ -0,0 +1,35 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(Config{Format: FormatJSON, Level: "warn"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestID(context.Background(), "r1")
+	logger.InfoContext(ctx, "skipped")
+	logger.With(KeySession, "s1").WarnContext(ctx, "kept")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("got %q, want a single JSON line: %v", buf.String(), err)
+	}
+	if line["msg"] != "kept" || line[KeyRequestID] != "r1" || line[KeySession] != "s1" {
+		t.Fatalf("got %v, want the warning with the request and session IDs", line)
+	}
+
+	if _, err := New(Config{Format: FormatText, Level: "loud"}, &buf); err == nil {
+		t.Fatal("got no error for an invalid level")
+	}
+	if _, err := New(Config{Format: "xml", Level: "info"}, &buf); err == nil {
+		t.Fatal("got no error for an invalid format")
+	}
+}
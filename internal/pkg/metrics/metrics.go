@@ -0,0 +1,166 @@
+// Package metrics holds the Prometheus metrics of the application.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "goapp"
+
+// Registry holds the application metrics and the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Session metrics, by transport.
+var (
+	SessionsActive = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions_active",
+		Help:      "Number of open sessions.",
+	}, []string{"transport"})
+
+	SessionsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sessions_total",
+		Help:      "Number of sessions opened.",
+	}, []string{"transport"})
+
+	MessagesSent = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Number of values delivered to sessions.",
+	}, []string{"transport"})
+
+	MessageBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_bytes_total",
+		Help:      "Bytes of the encoded messages sent to sessions, before compression.",
+	}, []string{"transport"})
+
+	BytesSent = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_sent_total",
+		Help:      "Bytes written to session connections.",
+	}, []string{"transport"})
+
+	Resets = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resets_total",
+		Help:      "Number of session counter resets.",
+	}, []string{"transport"})
+
+	Drops = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_values_total",
+		Help:      "Number of values dropped from full outbound queues.",
+	}, []string{"transport"})
+)
+
+// WebSocket metrics.
+var (
+	HandshakeFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_handshake_failures_total",
+		Help:      "Number of refused or failed WebSocket handshakes, by reason.",
+	}, []string{"reason"})
+
+	WriteLatency = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "websocket_write_seconds",
+		Help:      "Duration of WebSocket frame writes, by engine and frame kind.",
+		Buckets:   []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1},
+	}, []string{"engine", "frame"})
+
+	HeartbeatRTT = factory.NewSummary(prometheus.SummaryOpts{
+		Namespace:  namespace,
+		Name:       "heartbeat_rtt_seconds",
+		Help:       "Round trip of the WebSocket heartbeats, the average is sum / count.",
+		Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001},
+	})
+
+	HeartbeatRTTMin = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_rtt_min_seconds",
+		Help:      "Lowest round trip of the WebSocket heartbeats.",
+	})
+)
+
+// Handshake failure reasons.
+const (
+	ReasonOrigin   = "origin"   // Origin not allowed.
+	ReasonDraining = "draining" // Server shutting down.
+	ReasonUpgrade  = "upgrade"  // Invalid upgrade request or hijack failure.
+	ReasonSession  = "session"  // Session could not be started.
+)
+
+// Generator metrics.
+var (
+	Generated = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generated_values_total",
+		Help:      "Number of values produced by the string generator of this node.",
+	})
+
+	strChanLock sync.Mutex
+	strChanLen  prometheus.Collector
+	strChanCap  prometheus.Collector
+)
+
+var rttMin struct {
+	seconds float64
+	mu      sync.Mutex
+}
+
+// ObserveHeartbeatRTT adds a heartbeat round trip.
+func ObserveHeartbeatRTT(seconds float64) {
+	HeartbeatRTT.Observe(seconds)
+
+	rttMin.mu.Lock()
+	defer rttMin.mu.Unlock()
+	if rttMin.seconds == 0 || seconds < rttMin.seconds {
+		rttMin.seconds = seconds
+		HeartbeatRTTMin.Set(seconds)
+	}
+}
+
+// RegisterStrChan exposes the occupancy of the generator string channel,
+// replacing a channel registered before.
+func RegisterStrChan(ch chan string) {
+	strChanLock.Lock()
+	defer strChanLock.Unlock()
+
+	if strChanLen != nil {
+		Registry.Unregister(strChanLen)
+		Registry.Unregister(strChanCap)
+	}
+	strChanLen = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "generator_queue_length",
+		Help:      "Strings waiting in the generator channel.",
+	}, func() float64 { return float64(len(ch)) })
+	strChanCap = factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "generator_queue_capacity",
+		Help:      "Capacity of the generator channel.",
+	}, func() float64 { return float64(cap(ch)) })
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
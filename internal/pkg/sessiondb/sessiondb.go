@@ -0,0 +1,330 @@
+// Package sessiondb keeps the summaries of the ended sessions in an embedded
+// database file, with hourly rollups, and answers queries over them.
+package sessiondb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"goapp/internal/pkg/logging"
+	"goapp/internal/pkg/summary"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketSessions = []byte("sessions") // Records keyed by start time and ID.
+	bucketHourly   = []byte("hourly")   // Rollups keyed by start hour.
+)
+
+const (
+	openTimeout   = time.Second // Wait for another process holding the file.
+	pruneInterval = time.Hour   // Time between two prunes of the old sessions.
+	pruneBatch    = 1000        // Sessions deleted per transaction.
+)
+
+var (
+	minKeyTime = time.Unix(0, 0)
+	maxKeyTime = time.Unix(0, math.MaxInt64)
+)
+
+var ErrStopped = errors.New("session database stopped")
+
+// Query selects the stored sessions started within [From, To).
+type Query struct {
+	From        time.Time
+	To          time.Time
+	RemoteAddr  string        // Client address, with or without the port, empty matches all.
+	MinDuration time.Duration // Shortest session matched.
+	Limit       int           // Most sessions returned, 0 returns all.
+}
+
+// Rollup sums up sessions.
+type Rollup struct {
+	Sessions        int64   `json:"sessions"`
+	TotalDurationMs float64 `json:"totalDurationMs"`
+	AvgDurationMs   float64 `json:"avgDurationMs"`
+	MaxDurationMs   float64 `json:"maxDurationMs"`
+	Sent            int64   `json:"sent"`
+	WireBytes       int64   `json:"wireBytes"`
+	ReceivedBytes   int64   `json:"receivedBytes"`
+	Dropped         int64   `json:"dropped"`
+}
+
+// HourRollup sums up the sessions started within an hour.
+type HourRollup struct {
+	Hour time.Time `json:"hour"`
+	Rollup
+}
+
+type Config struct {
+	Path      string        // Database file.
+	Retention time.Duration // Sessions started longer ago are pruned, 0 keeps them. Hourly rollups are kept.
+}
+
+// Store is the session database. It is a summary.Sink.
+type Store struct {
+	cfg         Config
+	db          *bolt.DB
+	quitChannel chan struct{}
+	running     sync.WaitGroup
+}
+
+func New(cfg Config) *Store {
+	return &Store{
+		cfg:         cfg,
+		quitChannel: make(chan struct{}),
+	}
+}
+
+// Start opens the database file, creating it when missing, and prunes the
+// sessions older than the retention, Stop() must be called at the end.
+func (s *Store) Start() error {
+	if s.cfg.Retention < 0 {
+		return fmt.Errorf("invalid session retention %v", s.cfg.Retention)
+	}
+
+	db, err := bolt.Open(s.cfg.Path, 0o644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to open session database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketSessions, bucketHourly} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create session database buckets: %w", err)
+	}
+	s.db = db
+
+	if s.cfg.Retention > 0 {
+		s.running.Add(1)
+		go s.pruneLoop()
+	}
+	return nil
+}
+
+func (s *Store) Stop() {
+	if s.db != nil {
+		close(s.quitChannel)
+		s.running.Wait()
+		s.db.Close()
+	}
+}
+
+// pruneLoop prunes the sessions older than the retention, at start and then
+// every pruneInterval.
+func (s *Store) pruneLoop() {
+	defer s.running.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.Prune(time.Now().Add(-s.cfg.Retention)); err != nil {
+			slog.Error("session database prune error", logging.Err(err))
+		} else if n > 0 {
+			slog.Info("session database pruned", "sessions", n)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.quitChannel:
+			return
+		}
+	}
+}
+
+// Prune deletes the sessions started before t and returns their number. The
+// hourly rollups are kept.
+func (s *Store) Prune(t time.Time) (int, error) {
+	if s.db == nil {
+		return 0, ErrStopped
+	}
+
+	end := timeKey(t)
+	pruned := 0
+	for {
+		var keys [][]byte
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(bucketSessions)
+			c := b.Cursor()
+			// Collect the keys first, deleting under the cursor skips keys.
+			for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) < 0 && len(keys) < pruneBatch; k, _ = c.Next() {
+				keys = append(keys, bytes.Clone(k))
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return pruned, err
+		}
+		pruned += len(keys)
+		if len(keys) < pruneBatch {
+			return pruned, nil
+		}
+		select {
+		case <-s.quitChannel:
+			return pruned, nil
+		default:
+		}
+	}
+}
+
+// Write stores the summary of an ended session and adds it to the rollup of
+// the hour it started in.
+func (s *Store) Write(_ context.Context, r summary.Record) error {
+	if s.db == nil {
+		return ErrStopped
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketSessions).Put(sessionKey(r.Started, r.ID), data); err != nil {
+			return err
+		}
+
+		hourly := tx.Bucket(bucketHourly)
+		hour := r.Started.UTC().Truncate(time.Hour)
+		key := timeKey(hour)
+		rollup := HourRollup{Hour: hour}
+		if v := hourly.Get(key); v != nil {
+			if err := json.Unmarshal(v, &rollup); err != nil {
+				return err
+			}
+		}
+		rollup.add(r)
+		if data, err = json.Marshal(rollup); err != nil {
+			return err
+		}
+		return hourly.Put(key, data)
+	})
+}
+
+// Sessions returns the stored sessions matching q, oldest first.
+func (s *Store) Sessions(q Query) ([]summary.Record, error) {
+	if s.db == nil {
+		return nil, ErrStopped
+	}
+
+	records := []summary.Record{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSessions).Cursor()
+		end := timeKey(q.To)
+		for k, v := c.Seek(timeKey(q.From)); k != nil && bytes.Compare(k[:8], end) < 0; k, v = c.Next() {
+			var r summary.Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if !q.matches(r) {
+				continue
+			}
+			records = append(records, r)
+			if q.Limit > 0 && len(records) == q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// Hourly returns the rollups of the hours within [from, to), oldest first,
+// and their total.
+func (s *Store) Hourly(from, to time.Time) ([]HourRollup, Rollup, error) {
+	if s.db == nil {
+		return nil, Rollup{}, ErrStopped
+	}
+
+	rollups := []HourRollup{}
+	var total Rollup
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketHourly).Cursor()
+		end := timeKey(to)
+		for k, v := c.Seek(timeKey(from.UTC().Truncate(time.Hour))); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var r HourRollup
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			rollups = append(rollups, r)
+			total.merge(r.Rollup)
+		}
+		return nil
+	})
+	return rollups, total, err
+}
+
+func (q Query) matches(r summary.Record) bool {
+	if time.Duration(r.DurationMs*float64(time.Millisecond)) < q.MinDuration {
+		return false
+	}
+	if q.RemoteAddr == "" || r.RemoteAddr == q.RemoteAddr {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	return err == nil && host == q.RemoteAddr
+}
+
+func (r *Rollup) add(rec summary.Record) {
+	r.merge(Rollup{
+		Sessions:        1,
+		TotalDurationMs: rec.DurationMs,
+		MaxDurationMs:   rec.DurationMs,
+		Sent:            rec.Sent,
+		WireBytes:       rec.WireBytes,
+		ReceivedBytes:   rec.ReceivedBytes,
+		Dropped:         rec.Dropped,
+	})
+}
+
+func (r *Rollup) merge(o Rollup) {
+	r.Sessions += o.Sessions
+	r.TotalDurationMs += o.TotalDurationMs
+	r.MaxDurationMs = max(r.MaxDurationMs, o.MaxDurationMs)
+	r.Sent += o.Sent
+	r.WireBytes += o.WireBytes
+	r.ReceivedBytes += o.ReceivedBytes
+	r.Dropped += o.Dropped
+	if r.Sessions > 0 {
+		r.AvgDurationMs = r.TotalDurationMs / float64(r.Sessions)
+	}
+}
+
+// timeKey orders the keys by time, times out of the range of Unix
+// nanoseconds sort first or last.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	switch {
+	case t.Before(minKeyTime):
+	case t.After(maxKeyTime):
+		binary.BigEndian.PutUint64(key, math.MaxUint64)
+	default:
+		binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	}
+	return key
+}
+
+func sessionKey(started time.Time, id string) []byte {
+	return append(timeKey(started), id...)
+}
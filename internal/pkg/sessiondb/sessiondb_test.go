@@ -0,0 +1,132 @@
+package sessiondb
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/summary"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	s := New(Config{Path: path})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	records := []summary.Record{
+		{ID: "a", RemoteAddr: "10.0.0.1:1000", Started: day.Add(10 * time.Minute), DurationMs: 1000, Sent: 1},
+		{ID: "b", RemoteAddr: "10.0.0.2:1000", Started: day.Add(20 * time.Minute), DurationMs: 3000, Sent: 3},
+		{ID: "c", RemoteAddr: "10.0.0.1:2000", Started: day.Add(90 * time.Minute), DurationMs: 60000, Sent: 60},
+		{ID: "d", RemoteAddr: "10.0.0.1:3000", Started: day.Add(25 * time.Hour), DurationMs: 5000, Sent: 5},
+	}
+	for _, r := range records {
+		if err := s.Write(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reopened, the sessions are kept.
+	s.Stop()
+	s = New(Config{Path: path})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	got, err := s.Sessions(Query{From: day, To: day.Add(24 * time.Hour), RemoteAddr: "10.0.0.1", MinDuration: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "c" {
+		t.Fatalf("got %+v, want session c", got)
+	}
+
+	hours, total, err := s.Hourly(day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 2 || hours[0].Sessions != 2 || hours[0].MaxDurationMs != 3000 || hours[0].AvgDurationMs != 2000 || !hours[1].Hour.Equal(day.Add(time.Hour)) {
+		t.Fatalf("got %+v, want two hours of the day", hours)
+	}
+	if total.Sessions != 3 || total.Sent != 64 || total.TotalDurationMs != 64000 {
+		t.Fatalf("got total %+v, want the three sessions of the day", total)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	s := New(Config{Path: filepath.Join(t.TempDir(), "sessions.db")})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	n := pruneBatch + 5
+	for i := 0; i < n; i++ {
+		r := summary.Record{ID: fmt.Sprint(i), Started: old.Add(time.Duration(i) * time.Millisecond), Sent: 1}
+		if err := s.Write(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Write(context.Background(), summary.Record{ID: "new", Started: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned, err := s.Prune(time.Now().Add(-24 * time.Hour)); err != nil || pruned != n {
+		t.Fatalf("got %d pruned, error %v, want %d", pruned, err, n)
+	}
+	got, err := s.Sessions(Query{From: minKeyTime, To: maxKeyTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "new" {
+		t.Fatalf("got %d sessions, want the new one only", len(got))
+	}
+
+	// The rollups of the pruned sessions are kept.
+	if _, total, err := s.Hourly(old.Add(-time.Hour), old.Add(time.Hour)); err != nil || total.Sessions != int64(n) {
+		t.Fatalf("got %+v, error %v, want the rollups of %d sessions", total, err, n)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	s := New(Config{Path: path})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(context.Background(), summary.Record{ID: "old", Started: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+
+	if err := New(Config{Path: path, Retention: -time.Hour}).Start(); err == nil {
+		t.Fatal("started with a negative retention")
+	}
+
+	// The old sessions are pruned at start.
+	s = New(Config{Path: path, Retention: time.Hour})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := s.Sessions(Query{From: minKeyTime, To: maxKeyTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the old session to be pruned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
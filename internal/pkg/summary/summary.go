@@ -0,0 +1,279 @@
+// Package summary records a structured summary of every ended session and
+// routes it to a log, a file or a webhook.
+package summary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"goapp/internal/pkg/logging"
+)
+
+const (
+	queueSize      = 1024             // Records waiting for a sink.
+	webhookTimeout = 5 * time.Second  // Deadline of a webhook request.
+	drainTimeout   = 10 * time.Second // Records left at Stop are written within this time.
+)
+
+// Record is the summary of an ended session.
+type Record struct {
+	ID            string    `json:"id"`
+	Transport     string    `json:"transport"`
+	RequestID     string    `json:"requestId,omitempty"` // Request starting the session.
+	RemoteAddr    string    `json:"remoteAddr"`
+	UserAgent     string    `json:"userAgent,omitempty"`
+	Origin        string    `json:"origin,omitempty"`
+	Protocol      string    `json:"protocol,omitempty"` // Encoding or subprotocol.
+	Started       time.Time `json:"started"`
+	Ended         time.Time `json:"ended"`
+	DurationMs    float64   `json:"durationMs"`
+	Sent          int64     `json:"sent"`          // Values sent.
+	RawBytes      int64     `json:"rawBytes"`      // Message bytes sent, before compression.
+	WireBytes     int64     `json:"wireBytes"`     // Bytes written to the connection.
+	ReceivedBytes int64     `json:"receivedBytes"` // Message bytes received from the client.
+	Resets        int64     `json:"resets"`
+	Dropped       int64     `json:"dropped"`       // Values dropped from a full outbound queue.
+	MaxQueueDepth int       `json:"maxQueueDepth"` // Highest number of queued outbound messages.
+	CloseCode     int       `json:"closeCode,omitempty"`
+	CloseReason   string    `json:"closeReason,omitempty"`
+	RTT           *RTT      `json:"rtt,omitempty"`
+}
+
+// RTT sums up the heartbeat round trips of a session.
+type RTT struct {
+	Samples int64   `json:"samples"`
+	MinMs   float64 `json:"minMs"`
+	AvgMs   float64 `json:"avgMs"`
+	P99Ms   float64 `json:"p99Ms"`
+}
+
+// Sink receives the session summaries.
+type Sink interface {
+	Write(ctx context.Context, r Record) error
+}
+
+type Config struct {
+	Log     bool   // Log the summaries.
+	File    string // Append the summaries to this file as JSON lines, empty disables it.
+	Webhook string // POST every summary as JSON to this URL, empty disables it.
+}
+
+// Recorder queues the session summaries of every sink and writes them from a
+// goroutine per sink, so ending a session never waits for a sink and a slow
+// sink does not delay or drop the records of the others.
+type Recorder struct {
+	cfg         Config
+	sinks       []Sink
+	queues      []*sinkQueue
+	started     bool
+	mu          sync.Mutex
+	quitChannel chan struct{}
+	running     sync.WaitGroup
+}
+
+// sinkQueue holds the records waiting for a sink.
+type sinkQueue struct {
+	sink    Sink
+	records chan Record
+	dropped int64 // Records dropped from the full queue.
+}
+
+func New(cfg Config) *Recorder {
+	return &Recorder{
+		cfg:         cfg,
+		quitChannel: make(chan struct{}),
+	}
+}
+
+// AddSink adds a sink to the configured ones, before Start.
+func (r *Recorder) AddSink(sink Sink) {
+	r.sinks = append(r.sinks, sink)
+}
+
+// Start opens the configured sinks, Stop() must be called at the end.
+func (r *Recorder) Start() error {
+	if r.cfg.Log {
+		r.sinks = append(r.sinks, logSink{})
+	}
+	if r.cfg.File != "" {
+		f, err := os.OpenFile(r.cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open session summary file: %w", err)
+		}
+		r.sinks = append(r.sinks, &fileSink{f: f})
+	}
+	if r.cfg.Webhook != "" {
+		r.sinks = append(r.sinks, &webhookSink{url: r.cfg.Webhook, client: &http.Client{Timeout: webhookTimeout}})
+	}
+
+	r.mu.Lock()
+	for _, sink := range r.sinks {
+		r.queues = append(r.queues, &sinkQueue{sink: sink, records: make(chan Record, queueSize)})
+	}
+	r.started = true
+	r.mu.Unlock()
+
+	for _, q := range r.queues {
+		r.running.Add(1)
+		go r.loop(q)
+	}
+
+	return nil
+}
+
+// Stop writes the queued records, for up to drainTimeout, and closes the
+// sinks.
+func (r *Recorder) Stop() {
+	r.mu.Lock()
+	r.started = false
+	r.mu.Unlock()
+
+	close(r.quitChannel)
+	r.running.Wait()
+
+	for _, sink := range r.sinks {
+		if c, ok := sink.(interface{ Close() error }); ok {
+			c.Close()
+		}
+	}
+}
+
+// Record queues the summary of an ended session for every sink. Summaries
+// are dropped when the recorder is not running, or for the sinks whose queue
+// is full.
+func (r *Recorder) Record(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		return
+	}
+	for _, q := range r.queues {
+		select {
+		case q.records <- rec:
+		default:
+			q.dropped++
+			if q.dropped == 1 || q.dropped%1000 == 0 {
+				slog.Warn("session summary queue full", "sink", fmt.Sprintf("%T", q.sink), "dropped", q.dropped)
+			}
+		}
+	}
+}
+
+// loop writes the records of q to its sink.
+func (r *Recorder) loop(q *sinkQueue) {
+	defer r.running.Done()
+
+	for {
+		select {
+		case rec := <-q.records:
+			write(context.Background(), q.sink, rec)
+		case <-r.quitChannel:
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+			for {
+				select {
+				case rec := <-q.records:
+					write(ctx, q.sink, rec)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func write(ctx context.Context, sink Sink, rec Record) {
+	if err := sink.Write(ctx, rec); err != nil {
+		slog.Error("session summary error", logging.KeySession, rec.ID, logging.Err(err))
+	}
+}
+
+// logSink logs the summaries.
+type logSink struct{}
+
+func (logSink) Write(ctx context.Context, r Record) error {
+	attrs := []slog.Attr{
+		slog.String(logging.KeySession, r.ID),
+		slog.String(logging.KeyTransport, r.Transport),
+		slog.String(logging.KeyRequestID, r.RequestID),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.String("user_agent", r.UserAgent),
+		slog.String("origin", r.Origin),
+		slog.String("protocol", r.Protocol),
+		slog.Time("started", r.Started),
+		slog.Float64("duration_ms", r.DurationMs),
+		slog.Int64("sent", r.Sent),
+		slog.Int64("raw_bytes", r.RawBytes),
+		slog.Int64("wire_bytes", r.WireBytes),
+		slog.Int64("received_bytes", r.ReceivedBytes),
+		slog.Int64("resets", r.Resets),
+		slog.Int64("dropped", r.Dropped),
+		slog.Int("max_queue_depth", r.MaxQueueDepth),
+		slog.Int("close_code", r.CloseCode),
+		slog.String("close_reason", r.CloseReason),
+	}
+	if r.RTT != nil {
+		attrs = append(attrs, slog.Group("rtt",
+			slog.Int64("samples", r.RTT.Samples),
+			slog.Float64("min_ms", r.RTT.MinMs),
+			slog.Float64("avg_ms", r.RTT.AvgMs),
+			slog.Float64("p99_ms", r.RTT.P99Ms),
+		))
+	}
+	slog.LogAttrs(ctx, slog.LevelInfo, "session summary", attrs...)
+	return nil
+}
+
+// fileSink appends the summaries to a file as JSON lines.
+type fileSink struct {
+	f *os.File
+}
+
+func (s *fileSink) Write(_ context.Context, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+// webhookSink posts every summary as JSON.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Write(ctx context.Context, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
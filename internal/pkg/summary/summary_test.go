@@ -0,0 +1,185 @@
+package summary
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+
+	// record starts a recorder appending to the file, and stops it once the
+	// records are queued.
+	record := func(ids ...string) {
+		t.Helper()
+		r := New(Config{File: path})
+		if err := r.Start(); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			r.Record(Record{ID: id, Transport: "websocket", Sent: 3})
+		}
+		r.Stop()
+	}
+	record("1", "2")
+	record("3")
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var ids []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid line %q: %v", sc.Text(), err)
+		}
+		if rec.Transport != "websocket" || rec.Sent != 3 {
+			t.Fatalf("got %+v, want the recorded fields", rec)
+		}
+		ids = append(ids, rec.ID)
+	}
+	if len(ids) != 3 || ids[0] != "1" || ids[1] != "2" || ids[2] != "3" {
+		t.Fatalf("got records %v, want 1, 2 and 3 appended in order", ids)
+	}
+}
+
+func TestFileSinkOpenError(t *testing.T) {
+	r := New(Config{File: filepath.Join(t.TempDir(), "missing", "sessions.jsonl")})
+	if err := r.Start(); err == nil {
+		r.Stop()
+		t.Fatal("started with a file in a missing directory")
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	status := make(chan int, 1)
+	received := make(chan Record, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec Record
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			t.Error(err)
+		}
+		received <- rec
+		w.WriteHeader(<-status)
+	}))
+	defer srv.Close()
+
+	sink := &webhookSink{url: srv.URL, client: &http.Client{Timeout: webhookTimeout}}
+	for _, tt := range []struct {
+		status int
+		ok     bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusNoContent, true},
+		{http.StatusMovedPermanently, false},
+		{http.StatusBadRequest, false},
+		{http.StatusInternalServerError, false},
+	} {
+		status <- tt.status
+		err := sink.Write(context.Background(), Record{ID: "1", CloseCode: 1000})
+		if (err == nil) != tt.ok {
+			t.Fatalf("got error %v for status %d, want ok %t", err, tt.status, tt.ok)
+		}
+		if rec := <-received; rec.ID != "1" || rec.CloseCode != 1000 {
+			t.Fatalf("got %+v, want the written record", rec)
+		}
+	}
+}
+
+func TestWebhookSinkTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	sink := &webhookSink{url: srv.URL, client: &http.Client{Timeout: 50 * time.Millisecond}}
+	start := time.Now()
+	if err := sink.Write(context.Background(), Record{ID: "1"}); err == nil {
+		t.Fatal("got no error from a webhook not answering")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("the write returned after %v, want the client timeout", d)
+	}
+
+	// The context of the write ends it too, e.g. at the drain deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	sink.client.Timeout = 0
+	if err := sink.Write(ctx, Record{ID: "1"}); err == nil {
+		t.Fatal("got no error from a webhook not answering before the deadline")
+	}
+}
+
+// blockingSink waits for release before writing every record.
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s blockingSink) Write(ctx context.Context, _ Record) error {
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// countingSink counts the written records.
+type countingSink struct {
+	written chan string
+}
+
+func (s countingSink) Write(_ context.Context, r Record) error {
+	s.written <- r.ID
+	return nil
+}
+
+func TestSlowSink(t *testing.T) {
+	slow := blockingSink{release: make(chan struct{})}
+	fast := countingSink{written: make(chan string)}
+	r := New(Config{})
+	r.AddSink(slow)
+	r.AddSink(fast)
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow sink fills its queue, the other one gets every record.
+	for i := 0; i < queueSize+10; i++ {
+		r.Record(Record{ID: "1"})
+		select {
+		case <-fast.written:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("record %d not written", i)
+		}
+	}
+
+	r.mu.Lock()
+	slowDropped, fastDropped := r.queues[0].dropped, r.queues[1].dropped
+	r.mu.Unlock()
+	if slowDropped == 0 || fastDropped != 0 {
+		t.Fatalf("got %d and %d dropped, want drops from the slow sink only", slowDropped, fastDropped)
+	}
+
+	close(slow.release)
+	r.Stop()
+}
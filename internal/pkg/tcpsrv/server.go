@@ -0,0 +1,170 @@
+// Package tcpsrv serves the value stream over a plain TCP line protocol, for
+// embedded devices and netcat-style debugging.
+package tcpsrv
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"goapp/internal/pkg/httpsrv"
+	"goapp/internal/pkg/logging"
+)
+
+const (
+	transport    = "tcp"            // Session transport reported in statistics.
+	cmdReset     = "RESET"          // Resets the session counter.
+	writeTimeout = 10 * time.Second // Slow clients are disconnected.
+	maxLineSize  = 1024             // Longest command line accepted.
+)
+
+type Config struct {
+	Addr string // TCP listen address, empty disables the listener.
+}
+
+// Server accepts TCP connections and serves each one as a hub session. Every
+// value is written as an "iteration value" line, a "RESET" line resets the
+// counter.
+type Server struct {
+	cfg         Config
+	hub         *httpsrv.Server
+	listener    net.Listener
+	conns       map[net.Conn]struct{}
+	connsLock   sync.Mutex
+	quitChannel chan struct{}
+	running     sync.WaitGroup
+}
+
+func New(cfg Config, hub *httpsrv.Server) *Server {
+	return &Server{
+		cfg:         cfg,
+		hub:         hub,
+		conns:       make(map[net.Conn]struct{}),
+		quitChannel: make(chan struct{}),
+	}
+}
+
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.cfg.Addr, err)
+	}
+	s.listener = lis
+
+	s.running.Add(1)
+	go s.acceptLoop()
+
+	return nil
+}
+
+func (s *Server) Stop() {
+	close(s.quitChannel)
+	s.listener.Close()
+
+	s.connsLock.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsLock.Unlock()
+
+	s.running.Wait()
+}
+
+// Addr returns the listen address.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) acceptLoop() {
+	defer s.running.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quitChannel:
+			default:
+				slog.Error("TCP accept error", logging.Err(err))
+			}
+			return
+		}
+
+		s.connsLock.Lock()
+		s.conns[conn] = struct{}{}
+		s.connsLock.Unlock()
+
+		s.running.Add(1)
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.running.Done()
+	defer func() {
+		s.connsLock.Lock()
+		delete(s.conns, conn)
+		s.connsLock.Unlock()
+		conn.Close()
+	}()
+
+	sess, err := s.hub.OpenSession(transport, conn.RemoteAddr().String())
+	if err != nil {
+		slog.Error("failed to open TCP session", "remote_addr", conn.RemoteAddr().String(), logging.Err(err))
+		return
+	}
+	defer sess.Close()
+
+	// The reader hands replies to this goroutine, the only writer.
+	replyCh := make(chan string, 16)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, maxLineSize), maxLineSize)
+		for scanner.Scan() {
+			sess.Received(len(scanner.Bytes()) + 1)
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "":
+			case strings.EqualFold(line, cmdReset):
+				sess.Reset()
+			default:
+				select {
+				case replyCh <- fmt.Sprintf("ERROR unknown command %q\n", line):
+				default:
+				}
+			}
+		}
+	}()
+
+	for {
+		var (
+			line  string
+			value bool
+		)
+		select {
+		case counter := <-sess.Values():
+			line, value = fmt.Sprintf("%d %s\n", counter.Iteration, counter.Value), true
+		case line = <-replyCh:
+		case <-readDone:
+			sess.SetCloseReason("client disconnected")
+			return
+		case <-s.quitChannel:
+			sess.SetCloseReason("server stopped")
+			return
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write([]byte(line)); err != nil {
+			sess.SetCloseReason("write failed")
+			return
+		}
+		if value {
+			sess.Sent(len(line))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package tcpsrv
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"goapp/internal/pkg/broker"
+	"goapp/internal/pkg/httpsrv"
+)
+
+func TestLineProtocol(t *testing.T) {
+	b := broker.NewLocal()
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+
+	cfg := httpsrv.DefaultConfig()
+	cfg.Addr = "127.0.0.1:0"
+	hub := httpsrv.New(cfg, b)
+	if err := hub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Stop()
+
+	s := New(Config{Addr: "127.0.0.1:0"}, hub)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewReader(conn)
+
+	expect := func(want string) {
+		t.Helper()
+		line, err := lines.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSuffix(line, "\n"); line != want {
+			t.Fatalf("got %q, want %q", line, want)
+		}
+	}
+
+	// Wait for the session to join the hub.
+	for len(hub.AllSessionStats()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.Publish("A1")
+	expect("1 A1")
+	b.Publish("B2")
+	expect("2 B2")
+
+	conn.Write([]byte("reset\n"))
+	expect("0 B2")
+
+	conn.Write([]byte("HELLO\n"))
+	expect(`ERROR unknown command "HELLO"`)
+}
@@ -0,0 +1,156 @@
+// Package tracing sets up the OpenTelemetry tracer provider of the
+// application and the W3C trace context propagation.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"time"
+
+	"goapp/internal/pkg/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span exporters.
+const (
+	ExporterNone   = ""       // Spans are not recorded.
+	ExporterStdout = "stdout" // Spans are written to stdout as JSON.
+	ExporterOTLP   = "otlp"   // Spans are sent to an OTLP/HTTP collector.
+)
+
+// shutdownTimeout bounds the export of the spans left at Stop.
+const shutdownTimeout = 5 * time.Second
+
+type Config struct {
+	Exporter    string  // ExporterNone, ExporterStdout or ExporterOTLP.
+	Endpoint    string  // OTLP/HTTP collector URL, empty uses $OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318.
+	SampleRatio float64 // Share of the traces that are recorded, from 0 to 1, including those of clients.
+	ServiceName string  // Service name of the spans.
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SampleRatio: 1,
+		ServiceName: "goapp",
+	}
+}
+
+// Provider exports the spans of the application.
+type Provider struct {
+	cfg      Config
+	provider *sdktrace.TracerProvider // Nil when spans are not recorded.
+}
+
+func New(cfg Config) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+// Start makes the provider the global tracer provider and accepts the trace
+// context of incoming requests, Stop() must be called at the end.
+func (p *Provider) Start() error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("tracing error", logging.Err(err))
+	}))
+
+	if p.cfg.SampleRatio < 0 || p.cfg.SampleRatio > 1 {
+		return fmt.Errorf("invalid trace sample ratio %v", p.cfg.SampleRatio)
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch p.cfg.Exporter {
+	case ExporterNone:
+		return nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if p.cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(p.cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return fmt.Errorf("invalid trace exporter %q", p.cfg.Exporter)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(p.cfg.ServiceName),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	p.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler(p.cfg.SampleRatio)),
+	)
+	otel.SetTracerProvider(p.provider)
+
+	slog.Info("tracing started", "exporter", p.cfg.Exporter, "sample_ratio", p.cfg.SampleRatio)
+	return nil
+}
+
+// sampler records ratio of the traces started here and of the traces
+// continued from a remote parent, whose sampled flag and trace ID are chosen
+// by the client. Children of local spans follow their parent.
+func sampler(ratio float64) sdktrace.Sampler {
+	remote := randomSampler{ratio: ratio}
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio),
+		sdktrace.WithRemoteParentSampled(remote),
+		sdktrace.WithRemoteParentNotSampled(remote),
+	)
+}
+
+// randomSampler samples ratio of the spans at random, whatever their trace
+// ID.
+type randomSampler struct {
+	ratio float64
+}
+
+func (s randomSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if rand.Float64() < s.ratio {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s randomSampler) Description() string {
+	return fmt.Sprintf("RandomSampler{%g}", s.ratio)
+}
+
+// Stop exports the spans left, for up to shutdownTimeout.
+func (p *Provider) Stop() {
+	if p.provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := p.provider.Shutdown(ctx); err != nil {
+		slog.Error("tracing shutdown error", logging.Err(err))
+	}
+}
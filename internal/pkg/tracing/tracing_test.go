@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSampler(t *testing.T) {
+	remote := func(flags trace.TraceFlags) context.Context {
+		return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: flags,
+			Remote:     true,
+		}))
+	}
+
+	tests := []struct {
+		name   string
+		ratio  float64
+		parent context.Context
+		want   bool
+	}{
+		{"root never", 0, context.Background(), false},
+		{"root always", 1, context.Background(), true},
+		{"remote sampled never", 0, remote(trace.FlagsSampled), false},
+		{"remote sampled always", 1, remote(trace.FlagsSampled), true},
+		{"remote not sampled never", 0, remote(0), false},
+		{"remote not sampled always", 1, remote(0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler(tt.ratio)))
+			defer provider.Shutdown(context.Background())
+
+			ctx, span := provider.Tracer("test").Start(tt.parent, "parent")
+			if got := span.SpanContext().IsSampled(); got != tt.want {
+				t.Fatalf("got sampled %t, want %t", got, tt.want)
+			}
+			// Local children follow their parent.
+			_, child := provider.Tracer("test").Start(ctx, "child")
+			if got := child.SpanContext().IsSampled(); got != tt.want {
+				t.Fatalf("got child sampled %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
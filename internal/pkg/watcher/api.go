@@ -3,6 +3,7 @@ package watcher
 type Counter struct {
 	Iteration int    `json:"iteration"`
 	Value     string `json:"value"`
+	Seq       uint64 `json:"seq"` // Broker sequence of Value.
 }
 
 type CounterReset struct{}
\ No newline at end of file
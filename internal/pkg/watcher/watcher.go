@@ -1,79 +1,167 @@
 package watcher
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// sendTimeout bounds how long a value waits for a slow reader before it is
+// dropped.
+const sendTimeout = 100 * time.Millisecond
+
+// running counts the watcher goroutines of the process.
+var running atomic.Int64
+
+// Running returns the number of running watcher goroutines, to compare with
+// the number of sessions when looking for leaks.
+func Running() int64 {
+	return running.Load()
+}
+
+type input struct {
+	seq uint64
+	str string
+}
+
 type Watcher struct {
-	id          string         // Watcher ID.
-	inCh        chan string    // Input channel.
-	outCh       chan *Counter  // Updates to counter will notify this channel.
-	counter     *Counter       // The counter.
-	counterLock *sync.RWMutex  // Lock for counter.
-	quitChannel chan struct{}  // Quit.
-	running     sync.WaitGroup // Run, Amy, Run!
+	id          string             // Watcher ID.
+	inCh        chan input         // Input channel.
+	outCh       chan *Counter      // Updates to counter will notify this channel.
+	counter     *Counter           // The counter.
+	counterLock *sync.RWMutex      // Lock for counter.
+	ctx         context.Context    // Quit.
+	cancel      context.CancelFunc // Cancels ctx.
+	running     sync.WaitGroup     // Run, Amy, Run!
 }
 
 func New() *Watcher {
-	w := Watcher{}
-	w.id = uuid.NewString()
-	w.inCh = make(chan string, 1)
-	w.outCh = make(chan *Counter, 1)
-	w.counter = &Counter{Iteration: 0}
-	w.counterLock = &sync.RWMutex{}
-	w.quitChannel = make(chan struct{})
-	w.running = sync.WaitGroup{}
-	return &w
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watcher{
+		id:          uuid.NewString(),
+		inCh:        make(chan input, 1),
+		outCh:       make(chan *Counter, 1),
+		counter:     &Counter{Iteration: 0},
+		counterLock: &sync.RWMutex{},
+		ctx:         ctx,
+		cancel:      cancel,
+		running:     sync.WaitGroup{},
+	}
+	return w
 }
 
 // Start watcher in another Go routine, Stop() must be called at the end.
 func (w *Watcher) Start() error {
 	w.running.Add(1)
-	go func(wg *sync.WaitGroup) {
-		defer wg.Done()
-		for {
-			select {
-			case <-w.inCh:
-				w.counter.Iteration += 1
+	running.Add(1)
+	go w.mainLoop()
+	return nil
+}
+
+func (w *Watcher) mainLoop() {
+	defer w.running.Done()
+	defer running.Add(-1)
+
+	timer := time.NewTimer(sendTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case in := <-w.inCh:
+			if in.str == "" {
+				continue
+			}
+			w.counterLock.Lock()
+			if in.seq != 0 && in.seq <= w.counter.Seq {
+				// Already delivered by Next().
+				w.counterLock.Unlock()
+				continue
+			}
+			w.counter.Iteration++
+			w.counter.Value = in.str
+			w.counter.Seq = in.seq
+			counter := *w.counter
+			w.counterLock.Unlock()
+
+			if !timer.Stop() {
 				select {
-				case w.outCh <- w.counter:
-				case <-w.quitChannel:
-					return
+				case <-timer.C:
+				default:
 				}
-			case <-w.quitChannel:
+			}
+			timer.Reset(sendTimeout)
+
+			select {
+			case w.outCh <- &counter:
+			case <-w.ctx.Done():
 				return
+			case <-timer.C:
+				continue
 			}
 		}
-	}(&w.running)
-
-	return nil
+	}
 }
 
 func (w *Watcher) Stop() {
-	w.counterLock.Lock()
-	defer w.counterLock.Unlock()
-
-	close(w.quitChannel)
+	w.cancel()
 	w.running.Wait()
 }
 
-func (w *Watcher) GetWatcherId() string { return w.id }
+func (w *Watcher) GetWatcherId() string {
+	return w.id
+}
+
+// Send a value with its broker sequence to the watcher.
+func (w *Watcher) Send(seq uint64, str string) {
+	select {
+	case w.inCh <- input{seq: seq, str: str}:
+	case <-w.ctx.Done():
+	default:
+	}
+}
+
+// Next counts a value delivered outside of the watcher loop, e.g. replayed
+// from history, and returns the updated counter. Values sent later with the
+// same or a lower sequence are ignored.
+func (w *Watcher) Next(seq uint64, str string) Counter {
+	w.counterLock.Lock()
+	defer w.counterLock.Unlock()
 
-func (w *Watcher) Send(str string) { w.inCh <- str }
+	w.counter.Iteration++
+	w.counter.Value = str
+	w.counter.Seq = seq
+	return *w.counter
+}
 
-func (w *Watcher) Recv() <-chan *Counter { return w.outCh }
+func (w *Watcher) Recv() <-chan *Counter {
+	return w.outCh
+}
 
 func (w *Watcher) ResetCounter() {
 	w.counterLock.Lock()
 	defer w.counterLock.Unlock()
 
 	w.counter.Iteration = 0
+	counter := *w.counter
 
 	select {
-	case w.outCh <- w.counter:
-	case <-w.quitChannel:
-		return
+	case w.outCh <- &counter:
+	case <-w.ctx.Done():
+	default:
 	}
 }
+
+// Reset sets the counter to zero and returns it without sending it to the
+// receiver, for sessions delivering the values of Next() themselves.
+func (w *Watcher) Reset() Counter {
+	w.counterLock.Lock()
+	defer w.counterLock.Unlock()
+
+	w.counter.Iteration = 0
+	return *w.counter
+}
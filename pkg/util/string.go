@@ -3,6 +3,7 @@ package util
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"strings"
 	"sync"
 )
 
@@ -19,12 +20,12 @@ func (sr *SecureRandom) GenerateHex(length int) (string, error) {
 	defer sr.mu.Unlock()
 
 	bytes := make([]byte, (length+1)/2)
-	
+
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
 	}
 
-	hexStr := hex.EncodeToString(bytes)
+	hexStr := strings.ToUpper(hex.EncodeToString(bytes))
 
 	if len(hexStr) > length {
 		hexStr = hexStr[:length]
@@ -41,9 +42,3 @@ func RandString(n int) string {
 	}
 	return hexStr
 }
-
-func BenchmarkGenerateHex(length int) string {
-	sr := NewSecureRandom()
-	hexStr, _ := sr.GenerateHex(length)
-	return hexStr
-}
\ No newline at end of file
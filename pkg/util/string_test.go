@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"regexp"
 	"testing"
 )
@@ -73,4 +74,4 @@ func BenchmarkGenerateHex(b *testing.B) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}